@@ -49,42 +49,23 @@ func NewBasic(realm string, auth Authenticator, writer HtmlWriter) *Basic {
 // If the return value is blank, then the credentials are missing,
 // invalid, or a system error prevented verification.
 func (a *Basic) Authorize(r *http.Request) (username string) {
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		return ""
-	}
-
-	// Check that the token supplied corresponds to the basic authorization
-	// protocol
-	ndx := strings.IndexRune(token, ' ')
-	if ndx < 1 || token[0:ndx] != "Basic" {
-		return ""
-	}
-
-	// Drop prefix, and decode the base64
-	buffer, err := base64.StdEncoding.DecodeString(token[ndx+1:])
-	if err != nil {
-		return ""
-	}
-	token = string(buffer)
-
-	ndx = strings.IndexRune(token, ':')
-	if ndx < 1 {
+	username, password := a.ParseToken(r.Header.Get("Authorization"))
+	if username == "" {
 		return ""
 	}
 
-	if !a.Auth(token[0:ndx], token[ndx+1:], a.Realm) {
+	if !a.Auth(username, password, a.Realm) {
 		return ""
 	}
 
-	return token[0:ndx]
+	return username
 }
 
 // NotifyAuthRequired adds the headers to the HTTP response to
 // inform the client of the failed authorization, and which scheme
 // must be used to gain authentication.
 func (a *Basic) NotifyAuthRequired(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("WWW-Authenticate", "Basic realm=\""+a.Realm+"\"")
+	w.Header().Set("WWW-Authenticate", "Basic realm="+quoteString(a.Realm))
 	w.WriteHeader(http.StatusUnauthorized)
 	a.WriterUnauthorized(w, r)
 }
@@ -102,19 +83,19 @@ func (a *Basic) ParseToken(token string) (username, password string) {
 
 	// Check that the token supplied corresponds to the basic authorization
 	// protocol
-	ndx := strings.IndexRune(token, ' ')
-	if ndx < 1 || token[0:ndx] != "Basic" {
+	credentials, err := ParseCredentials(token)
+	if err != nil || !strings.EqualFold(credentials.Scheme, "Basic") {
 		return "", ""
 	}
 
-	// Drop prefix, and decode the base64
-	buffer, err := base64.StdEncoding.DecodeString(token[ndx+1:])
+	// Decode the base64
+	buffer, err := base64.StdEncoding.DecodeString(credentials.Token68)
 	if err != nil {
 		return "", ""
 	}
 	token = string(buffer)
 
-	ndx = strings.IndexRune(token, ':')
+	ndx := strings.IndexRune(token, ':')
 	if ndx < 1 {
 		return "", ""
 	}
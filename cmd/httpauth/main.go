@@ -0,0 +1,365 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command httpauth manages credential files and tests authentication
+// policies, using the same code as the package httpauth.
+//
+// Usage:
+//
+//	httpauth htdigest [-D] [-password pw] file realm user
+//	httpauth htdigest -l file realm
+//	httpauth htpasswd [-D] [-format bcrypt] [-password pw] file user
+//	httpauth htpasswd -l file
+//	httpauth verify [-htdigest file -realm realm | -htpasswd file] [-password pw] user
+//	httpauth digest [flags]
+//	httpauth challenge [flags] basic|digest|cookie
+//
+// The subcommands htdigest and htpasswd add a user, or update the password
+// of an existing user.  With -D, the user is deleted instead.  With -l, the
+// users are listed.  The subcommand verify checks a user's password against
+// a credential file, and exits with a non-zero status if the password is
+// incorrect.  If the password is not given using -password, it is read from
+// the first line of the standard input.
+//
+// The subcommand digest calculates the response for the digest
+// authentication scheme, and prints the Authorization header that a client
+// would send.  The subcommand challenge prints the response headers that a
+// policy sends when authorization is required.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+
+	httpauth "github.com/saintfish/httpauth-go"
+)
+
+// The exit status when a command is used incorrectly.
+const exitUsage = 2
+
+var errUsage = errors.New("incorrect usage")
+
+type command struct {
+	name  string
+	usage string
+	run   func(c *context, args []string) error
+}
+
+var commands = []command{
+	{"htdigest", "[-D] [-password pw] file realm user | -l file realm", runHtdigest},
+	{"htpasswd", "[-D] [-format bcrypt] [-password pw] file user | -l file", runHtpasswd},
+	{"verify", "[-htdigest file -realm realm | -htpasswd file] [-password pw] user", runVerify},
+	{"digest", "[flags]", runDigest},
+	{"challenge", "[flags] basic|digest|cookie", runChallenge},
+}
+
+// A context holds the standard streams for a command.
+type context struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &context{stdin, stdout, stderr}
+
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if cmd.name != args[0] {
+				continue
+			}
+			switch err := cmd.run(c, args[1:]); {
+			case err == errUsage:
+				fmt.Fprintf(stderr, "usage: httpauth %s %s\n", cmd.name, cmd.usage)
+				return exitUsage
+			case err == flag.ErrHelp:
+				return exitUsage
+			case err != nil:
+				fmt.Fprintf(stderr, "httpauth %s: %s\n", cmd.name, err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintln(stderr, "usage: httpauth command [arguments]")
+	for _, cmd := range commands {
+		fmt.Fprintf(stderr, "\thttpauth %s %s\n", cmd.name, cmd.usage)
+	}
+	return exitUsage
+}
+
+func (c *context) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// The function password returns the password given on the command line,
+// or reads it from the first line of the standard input.
+func (c *context) password(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	line, err := bufio.NewReader(c.stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("missing password")
+	}
+	return line, nil
+}
+
+func (c *context) printUsers(users []string) {
+	for _, user := range users {
+		fmt.Fprintln(c.stdout, user)
+	}
+}
+
+func runHtdigest(c *context, args []string) error {
+	fs := c.flagSet("htdigest")
+	del := fs.Bool("D", false, "delete the user")
+	list := fs.Bool("l", false, "list the users in the realm")
+	password := fs.String("password", "", "the user's password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *list && fs.NArg() == 2:
+		users, err := (&httpauth.HtdigestFile{Path: fs.Arg(0)}).List(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		c.printUsers(users)
+		return nil
+	case *list || fs.NArg() != 3:
+		return errUsage
+	}
+
+	f := &httpauth.HtdigestFile{Path: fs.Arg(0)}
+	realm, user := fs.Arg(1), fs.Arg(2)
+	if *del {
+		return f.Delete(user, realm)
+	}
+
+	pw, err := c.password(*password)
+	if err != nil {
+		return err
+	}
+	err = f.Add(user, realm, pw)
+	if err == httpauth.ErrUserExists {
+		err = f.Update(user, realm, pw)
+	}
+	return err
+}
+
+func runHtpasswd(c *context, args []string) error {
+	fs := c.flagSet("htpasswd")
+	del := fs.Bool("D", false, "delete the user")
+	list := fs.Bool("l", false, "list the users")
+	format := fs.String("format", httpauth.HashBcrypt, "the password hash format (bcrypt, apr1, sha1, crypt, or plain)")
+	password := fs.String("password", "", "the user's password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *list && fs.NArg() == 1:
+		users, err := (&httpauth.HtpasswdFile{Path: fs.Arg(0)}).List()
+		if err != nil {
+			return err
+		}
+		c.printUsers(users)
+		return nil
+	case *list || fs.NArg() != 2:
+		return errUsage
+	}
+
+	f := &httpauth.HtpasswdFile{Path: fs.Arg(0), Format: *format}
+	user := fs.Arg(1)
+	if *del {
+		return f.Delete(user)
+	}
+
+	pw, err := c.password(*password)
+	if err != nil {
+		return err
+	}
+	err = f.Add(user, pw)
+	if err == httpauth.ErrUserExists {
+		err = f.Update(user, pw)
+	}
+	return err
+}
+
+func runVerify(c *context, args []string) error {
+	fs := c.flagSet("verify")
+	htdigest := fs.String("htdigest", "", "the htdigest file")
+	htpasswd := fs.String("htpasswd", "", "the htpasswd file")
+	realm := fs.String("realm", "", "the realm, for htdigest files")
+	password := fs.String("password", "", "the user's password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (*htdigest == "") == (*htpasswd == "") {
+		return errUsage
+	}
+
+	// Open the file in the same way as a server would
+	var auth httpauth.Authenticator
+	if *htdigest != "" {
+		if *realm == "" {
+			return errUsage
+		}
+		lookup, err := httpauth.OpenHtdigest(*htdigest, nil)
+		if err != nil {
+			return err
+		}
+		auth = func(username, password, realm string) bool {
+			ha1 := lookup(username, realm)
+			return ha1 != "" && ha1 == httpauth.CalcHA1(username, realm, password)
+		}
+	} else {
+		var err error
+		if auth, err = httpauth.OpenHtpasswd(*htpasswd, nil); err != nil {
+			return err
+		}
+	}
+
+	pw, err := c.password(*password)
+	if err != nil {
+		return err
+	}
+	if !auth(fs.Arg(0), pw, *realm) {
+		return httpauth.ErrBadUsernameOrPassword
+	}
+	fmt.Fprintln(c.stdout, "OK")
+	return nil
+}
+
+func runDigest(c *context, args []string) error {
+	params := make(map[string]string)
+	fs := c.flagSet("digest")
+	for _, v := range []struct{ name, value, usage string }{
+		{"username", "", "the username"},
+		{"realm", "", "the realm from the challenge"},
+		{"nonce", "", "the nonce from the challenge"},
+		{"opaque", "", "the opaque value from the challenge"},
+		{"uri", "/", "the request URI"},
+		{"algorithm", httpauth.AlgorithmMD5, "the hash algorithm"},
+		{"qop", httpauth.QopAuth, "the quality of protection (auth or auth-int)"},
+		{"nc", "00000001", "the nonce count, in hexadecimal"},
+		{"cnonce", "0a4f113b", "the client nonce"},
+	} {
+		v := v
+		params[v.name] = v.value
+		fs.Func(v.name, v.usage+" (default "+fmt.Sprintf("%q", v.value)+")", func(s string) error {
+			params[v.name] = s
+			return nil
+		})
+	}
+	method := fs.String("method", "GET", "the request method")
+	bodyFile := fs.String("body", "", "a file containing the request body, for auth-int")
+	password := fs.String("password", "", "the user's password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || params["username"] == "" || params["nonce"] == "" {
+		return errUsage
+	}
+
+	var body []byte
+	if *bodyFile != "" {
+		var err error
+		if body, err = ioutil.ReadFile(*bodyFile); err != nil {
+			return err
+		}
+	}
+
+	pw, err := c.password(*password)
+	if err != nil {
+		return err
+	}
+	response, err := httpauth.CalcDigestResponse(params, pw, *method, body)
+	if err != nil {
+		return err
+	}
+	params["response"] = response
+	if params["opaque"] == "" {
+		delete(params, "opaque")
+	}
+
+	credentials := httpauth.Credentials{Scheme: "Digest", Params: params}
+	fmt.Fprintln(c.stdout, "Authorization: "+credentials.String())
+	return nil
+}
+
+func runChallenge(c *context, args []string) error {
+	fs := c.flagSet("challenge")
+	realm := fs.String("realm", "", "the realm")
+	algorithms := fs.String("algorithms", "", "comma separated list of digest algorithms (default depends on -plain)")
+	qop := fs.String("qop", httpauth.QopAuth, "comma separated list of digest qop options")
+	plain := fs.Bool("plain", true, "whether the digest policy can access plain passwords")
+	login := fs.String("login", "/login", "the login page for the cookie policy")
+	uri := fs.String("uri", "/", "the request URI")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	var policy httpauth.Policy
+	switch strings.ToLower(fs.Arg(0)) {
+	case "basic":
+		policy = httpauth.NewBasic(*realm, nil, nil)
+	case "digest":
+		digest, err := httpauth.NewDigest(*realm, nil, *plain, nil)
+		if err != nil {
+			return err
+		}
+		if *algorithms != "" {
+			digest.Algorithms = strings.Split(*algorithms, ",")
+		}
+		digest.Qop = strings.Split(*qop, ",")
+		policy = digest
+	case "cookie":
+		policy = httpauth.NewCookie(*realm, *login, nil)
+	default:
+		return errUsage
+	}
+
+	w := httptest.NewRecorder()
+	policy.NotifyAuthRequired(w, httptest.NewRequest("GET", *uri, nil))
+
+	fmt.Fprintf(c.stdout, "%d %s\n", w.Code, http.StatusText(w.Code))
+	names := make([]string, 0, len(w.Header()))
+	for name := range w.Header() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range w.Header()[name] {
+			fmt.Fprintf(c.stdout, "%s: %s\n", name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if code != 0 {
+		t.Logf("Stderr:  %s", stderr.String())
+	}
+	return stdout.String(), code
+}
+
+func TestHtdigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "htdigest")
+
+	if _, code := runCommand(t, "password\n", "htdigest", filename, "golang", "user"); code != 0 {
+		t.Fatalf("Incorrect exit status: %d", code)
+	}
+	if _, code := runCommand(t, "", "verify", "-htdigest", filename, "-realm", "golang", "-password", "password", "user"); code != 0 {
+		t.Errorf("Incorrect exit status: %d", code)
+	}
+
+	// Updating the password
+	if _, code := runCommand(t, "", "htdigest", "-password", "secret", filename, "golang", "user"); code != 0 {
+		t.Fatalf("Incorrect exit status: %d", code)
+	}
+	if _, code := runCommand(t, "password", "verify", "-htdigest", filename, "-realm", "golang", "user"); code != 1 {
+		t.Errorf("Incorrect exit status: %d", code)
+	}
+	if out, _ := runCommand(t, "", "htdigest", "-l", filename, "golang"); out != "user\n" {
+		t.Errorf("Incorrect list: %q", out)
+	}
+
+	if _, code := runCommand(t, "", "htdigest", "-D", filename, "golang", "user"); code != 0 {
+		t.Errorf("Incorrect exit status: %d", code)
+	}
+	if out, _ := runCommand(t, "", "htdigest", "-l", filename, "golang"); out != "" {
+		t.Errorf("Incorrect list: %q", out)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "htpasswd")
+
+	if _, code := runCommand(t, "password\n", "htpasswd", "-format", "apr1", filename, "user"); code != 0 {
+		t.Fatalf("Incorrect exit status: %d", code)
+	}
+	if out, code := runCommand(t, "password\n", "verify", "-htpasswd", filename, "user"); code != 0 || out != "OK\n" {
+		t.Errorf("Incorrect result: %d %q", code, out)
+	}
+	if _, code := runCommand(t, "wrong\n", "verify", "-htpasswd", filename, "user"); code != 1 {
+		t.Errorf("Incorrect exit status: %d", code)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	// Example from RFC 2617, section 3.5
+	out, code := runCommand(t, "Circle Of Life\n", "digest",
+		"-username", "Mufasa", "-realm", "testrealm@host.com",
+		"-nonce", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "-uri", "/dir/index.html",
+		"-nc", "00000001", "-cnonce", "0a4f113b")
+	if code != 0 {
+		t.Fatalf("Incorrect exit status: %d", code)
+	}
+	// The parameters algorithm, qop, and nc must not be quoted (RFC 7616,
+	// section 3.4)
+	expected := `Authorization: Digest algorithm=MD5, cnonce="0a4f113b", nc=00000001, ` +
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", qop=auth, realm="testrealm@host.com", ` +
+		`response="6629fae49393a05397450978507c4ef1", uri="/dir/index.html", username="Mufasa"` + "\n"
+	if out != expected {
+		t.Errorf("Incorrect output: %s", out)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	out, code := runCommand(t, "", "challenge", "-realm", "golang", "basic")
+	if code != 0 {
+		t.Fatalf("Incorrect exit status: %d", code)
+	}
+	if !strings.Contains(out, "401 Unauthorized\n") || !strings.Contains(out, `Www-Authenticate: Basic realm="golang"`) {
+		t.Errorf("Incorrect output: %s", out)
+	}
+
+	out, _ = runCommand(t, "", "challenge", "-realm", "golang", "-algorithms", "SHA-256", "digest")
+	if strings.Count(out, "Www-Authenticate: Digest") != 1 || !strings.Contains(out, "algorithm=SHA-256") {
+		t.Errorf("Incorrect output: %s", out)
+	}
+
+	if _, code := runCommand(t, "", "challenge", "unknown"); code != exitUsage {
+		t.Errorf("Incorrect exit status: %d", code)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNoKeys is returned when a codec is created without any keys.
+var ErrNoKeys = errors.New("At least one key is required.")
+
+// A SessionCodec protects values that are stored by clients in cookies,
+// such as the tokens of stateless sessions.  Codecs hold a keyring.  The
+// first key is used to protect new values, while values protected by any of
+// the keys are accepted, so that keys can be rotated without invalidating
+// existing cookies.  Codecs are safe for concurrent use.
+type SessionCodec interface {
+	// Encode protects the data, and returns a value that can be stored in a
+	// cookie.  The value is bound to the realm.
+	Encode(realm string, data []byte) (string, error)
+	// Decode verifies that the value was created by Encode for the realm,
+	// and returns the original data.  If the value cannot be verified, the
+	// error ErrInvalidToken is returned.
+	Decode(realm, value string) ([]byte, error)
+}
+
+type signedCodec struct {
+	keys [][]byte
+}
+
+// NewSignedCodec creates a codec that signs values using HMAC-SHA256.  The
+// data can be read by clients, but cannot be modified.
+func NewSignedCodec(keys [][]byte) (SessionCodec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return &signedCodec{keys}, nil
+}
+
+func (c *signedCodec) Encode(realm string, data []byte) (string, error) {
+	buffer := append(append([]byte(nil), data...), signNonce(c.keys[0], realm, data)...)
+	return base64.StdEncoding.EncodeToString(buffer), nil
+}
+
+func (c *signedCodec) Decode(realm, value string) ([]byte, error) {
+	buffer, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(buffer) < signedNonceMacLen {
+		return nil, ErrInvalidToken
+	}
+
+	data, sig := buffer[:len(buffer)-signedNonceMacLen], buffer[len(buffer)-signedNonceMacLen:]
+	for _, key := range c.keys {
+		if hmac.Equal(sig, signNonce(key, realm, data)) {
+			return data, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// The length of the key identifiers used by aeadCodec.
+const aeadKeyIDLen = 4
+
+type aeadCodec struct {
+	ids   [][aeadKeyIDLen]byte
+	aeads []cipher.AEAD
+}
+
+// NewAEADCodec creates a codec that encrypts values using AES-GCM, so that
+// the data can be neither read nor modified by clients.  Keys must be 16,
+// 24, or 32 bytes long, to select AES-128, AES-192, or AES-256.
+//
+// Encrypted values are tagged with an identifier derived from the key, so
+// that only the matching key is tried when decrypting.
+func NewAEADCodec(keys [][]byte) (SessionCodec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	c := &aeadCodec{}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		var id [aeadKeyIDLen]byte
+		sum := sha256.Sum256(key)
+		copy(id[:], sum[:])
+		c.ids = append(c.ids, id)
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+func (c *aeadCodec) Encode(realm string, data []byte) (string, error) {
+	aead := c.aeads[0]
+	buffer := make([]byte, aeadKeyIDLen+aead.NonceSize(), aeadKeyIDLen+aead.NonceSize()+len(data)+aead.Overhead())
+
+	copy(buffer, c.ids[0][:])
+	nonce := buffer[aeadKeyIDLen:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	buffer = aead.Seal(buffer, nonce, data, []byte(realm))
+	return base64.StdEncoding.EncodeToString(buffer), nil
+}
+
+func (c *aeadCodec) Decode(realm, value string) ([]byte, error) {
+	buffer, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(buffer) < aeadKeyIDLen {
+		return nil, ErrInvalidToken
+	}
+
+	for i, id := range c.ids {
+		aead := c.aeads[i]
+		if string(id[:]) != string(buffer[:aeadKeyIDLen]) || len(buffer) < aeadKeyIDLen+aead.NonceSize()+aead.Overhead() {
+			continue
+		}
+		nonce, ciphertext := buffer[aeadKeyIDLen:aeadKeyIDLen+aead.NonceSize()], buffer[aeadKeyIDLen+aead.NonceSize():]
+		if data, err := aead.Open(nil, nonce, ciphertext, []byte(realm)); err == nil {
+			return data, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// A sessionToken holds the details of a stateless session, which are
+// stored by the client in a protected cookie.
+type sessionToken struct {
+	id       [sessionIDLen]byte // random identifier for the session
+	username string             // username for this authorized session
+	issued   time.Time          // time when the user logged in
+	expires  time.Time          // time after which the token is no longer accepted
+	values   map[string]string  // data attached to the session
+	flashes  []string           // messages to be shown once
+}
+
+// The structure sessionTokenData holds the optional parts of a session
+// token, which are encoded using JSON.
+type sessionTokenData struct {
+	Values  map[string]string `json:"v,omitempty"`
+	Flashes []string          `json:"f,omitempty"`
+}
+
+// The length of the fixed fields of an encoded session token, which are a
+// tag, the issue and expiry times, and the random session identifier.  The
+// tag ensures that signed nonces are never accepted as session tokens.  The
+// fixed fields are followed by the length of the username, the username,
+// and then any values or flashes.
+const (
+	sessionIDLen          = 8
+	sessionTokenTag       = 'S'
+	sessionTokenHeaderLen = 1 + 8 + 8 + sessionIDLen
+)
+
+// The function newSessionToken creates the details for a new session, with
+// a random identifier.
+func newSessionToken(username string, issued, expires time.Time) (sessionToken, error) {
+	session := sessionToken{username: username, issued: issued, expires: expires}
+	if _, err := io.ReadFull(rand.Reader, session.id[:]); err != nil {
+		return sessionToken{}, err
+	}
+	return session, nil
+}
+
+// The function sessionID returns the identifier of the session, which can be
+// shared without granting access to the session.
+func (s *sessionToken) sessionID() string {
+	return base64.StdEncoding.EncodeToString(s.id[:])
+}
+
+func (s *sessionToken) marshal() ([]byte, error) {
+	buffer := make([]byte, sessionTokenHeaderLen, sessionTokenHeaderLen+binary.MaxVarintLen64+len(s.username))
+	buffer[0] = sessionTokenTag
+	binary.BigEndian.PutUint64(buffer[1:9], uint64(s.issued.UnixNano()))
+	binary.BigEndian.PutUint64(buffer[9:17], uint64(s.expires.UnixNano()))
+	copy(buffer[17:], s.id[:])
+	buffer = binary.AppendUvarint(buffer, uint64(len(s.username)))
+	buffer = append(buffer, s.username...)
+
+	if len(s.values) == 0 && len(s.flashes) == 0 {
+		return buffer, nil
+	}
+	data, err := json.Marshal(sessionTokenData{s.values, s.flashes})
+	if err != nil {
+		return nil, err
+	}
+	return append(buffer, data...), nil
+}
+
+func unmarshalSessionToken(data []byte) (session sessionToken, ok bool) {
+	if len(data) < sessionTokenHeaderLen || data[0] != sessionTokenTag {
+		return sessionToken{}, false
+	}
+
+	session.issued = time.Unix(0, int64(binary.BigEndian.Uint64(data[1:9])))
+	session.expires = time.Unix(0, int64(binary.BigEndian.Uint64(data[9:17])))
+	copy(session.id[:], data[17:sessionTokenHeaderLen])
+
+	data = data[sessionTokenHeaderLen:]
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)-size) {
+		return sessionToken{}, false
+	}
+	session.username = string(data[size : size+int(n)])
+
+	if data = data[size+int(n):]; len(data) > 0 {
+		var extra sessionTokenData
+		if err := json.Unmarshal(data, &extra); err != nil {
+			return sessionToken{}, false
+		}
+		session.values, session.flashes = extra.Values, extra.Flashes
+	}
+	return session, true
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionCodec(t *testing.T) {
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+
+	constructors := []struct {
+		name string
+		new  func(keys [][]byte) (SessionCodec, error)
+	}{
+		{"signed", NewSignedCodec},
+		{"aead", NewAEADCodec},
+	}
+
+	for _, v := range constructors {
+		if _, err := v.new(nil); err != ErrNoKeys {
+			t.Errorf("%s: incorrect error: %v", v.name, err)
+		}
+
+		old, err := v.new([][]byte{key1})
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		value, err := old.Encode("golang", []byte("secret data"))
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+
+		// After rotation, values protected using the old key are accepted
+		rotated, err := v.new([][]byte{key2, key1})
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		if data, err := rotated.Decode("golang", value); err != nil || string(data) != "secret data" {
+			t.Errorf("%s: incorrect data: %q %v", v.name, data, err)
+		}
+		value2, err := rotated.Encode("golang", []byte("secret data"))
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		if _, err := old.Decode("golang", value2); err != ErrInvalidToken {
+			t.Errorf("%s: accepted value protected using an unknown key", v.name)
+		}
+
+		// Values are bound to the realm
+		if _, err := rotated.Decode("other", value); err != ErrInvalidToken {
+			t.Errorf("%s: accepted value for another realm", v.name)
+		}
+
+		// Tampered values are rejected
+		buffer, _ := base64.StdEncoding.DecodeString(value)
+		for i := range buffer {
+			buffer[i] ^= 0x80
+			if _, err := rotated.Decode("golang", base64.StdEncoding.EncodeToString(buffer)); err != ErrInvalidToken {
+				t.Errorf("%s: accepted value modified at byte %d", v.name, i)
+			}
+			buffer[i] ^= 0x80
+		}
+		if _, err := rotated.Decode("golang", "not base64!"); err != ErrInvalidToken {
+			t.Errorf("%s: accepted malformed value", v.name)
+		}
+	}
+
+	if _, err := NewAEADCodec([][]byte{[]byte("short")}); err == nil {
+		t.Errorf("Accepted key with an invalid length.")
+	}
+}
+
+func TestCookieAEADCodec(t *testing.T) {
+	codec, err := NewAEADCodec([][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+		return realm == "golang" && username == password
+	})
+	policy.SessionCodec = codec
+
+	w := httptest.NewRecorder()
+	if err := policy.Login(w, "username1", "username1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	buffer, _ := base64.StdEncoding.DecodeString(cookie.Value)
+	if strings.Contains(string(buffer), "username1") {
+		t.Errorf("Token is not encrypted.")
+	}
+
+	r := httptest.NewRequest("GET", "/cookie/", nil)
+	r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	if username := policy.Authorize(r); username != "username1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+}
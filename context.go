@@ -0,0 +1,90 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+)
+
+// An Identity describes the client authorized for an HTTP request.  Handlers
+// wrapped using NewHandlerWithAuth can retrieve the identity from the
+// request's context using FromContext.
+type Identity struct {
+	// Username is the name returned by the policy's Authorize method.
+	Username string
+	// Realm is the 'namespace' where the authentication was considered.
+	Realm string
+	// Scheme names the authentication scheme used (e.g. Basic, Digest, or Cookie).
+	Scheme string
+	// SessionID identifies the client's session, if the scheme uses sessions.
+	// For the digest scheme, this is the server nonce.  For the cookie
+	// scheme with stateless sessions, this is the ID within the token, which
+	// does not grant access.  However, for the cookie scheme with stored
+	// sessions, this is the session token itself, which grants access to
+	// the session, and so must not be logged or shown to other users.
+	SessionID string
+}
+
+// An Identifier is a Policy that can supply additional details about an
+// authorized client.  Identify is called after a successful call to
+// Authorize with the username that was returned.
+type Identifier interface {
+	Identify(request *http.Request, username string) *Identity
+}
+
+type contextKey int
+
+const identityKey contextKey = 0
+
+// NewContext returns a copy of the parent context that carries the identity.
+func NewContext(parent context.Context, id *Identity) context.Context {
+	return context.WithValue(parent, identityKey, id)
+}
+
+// FromContext retrieves the identity stored in the context, if any.
+func FromContext(ctx context.Context) (id *Identity, ok bool) {
+	id, ok = ctx.Value(identityKey).(*Identity)
+	return id, ok && id != nil
+}
+
+// UsernameFromContext returns the username of the identity stored in the
+// context.  If the context does not carry an identity, the empty string
+// is returned.
+func UsernameFromContext(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id.Username
+	}
+	return ""
+}
+
+// Identify returns the identity of the client authorized by Authorize.
+func (a *Basic) Identify(r *http.Request, username string) *Identity {
+	return &Identity{Username: username, Realm: a.Realm, Scheme: "Basic"}
+}
+
+// Identify returns the identity of the client authorized by Authorize.
+func (a *Digest) Identify(r *http.Request, username string) *Identity {
+	id := &Identity{Username: username, Realm: a.Realm, Scheme: "Digest"}
+	if params := parseDigestAuthHeader(r); params != nil {
+		id.SessionID = params["nonce"]
+	}
+	return id
+}
+
+// Identify returns the identity of the client authorized by Authorize.  For
+// stored sessions, the SessionID is the session token, which is a bearer
+// credential.  See Identity.
+func (a *Cookie) Identify(r *http.Request, username string) *Identity {
+	id := &Identity{Username: username, Realm: a.Realm, Scheme: "Cookie"}
+	if token, err := r.Cookie(a.CookieOptions.CookieName()); err == nil {
+		id.SessionID = token.Value
+		// Stateless sessions are identified by the ID within the token
+		if session, ok := a.decodeSession(token.Value); ok {
+			id.SessionID = session.sessionID()
+		}
+	}
+	return id
+}
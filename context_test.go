@@ -0,0 +1,101 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	// Ensure that the policies supply identities to wrapped handlers.
+	_ Identifier = &Basic{}
+	_ Identifier = &Digest{}
+	_ Identifier = &Cookie{}
+)
+
+func identityHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing identity.", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s:%s:%s", id.Scheme, id.Realm, id.Username)
+}
+
+func TestContextEmpty(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("Found identity in empty context.")
+	}
+	if username := UsernameFromContext(context.Background()); username != "" {
+		t.Errorf("Found username in empty context: %s", username)
+	}
+}
+
+func TestContextUsername(t *testing.T) {
+	ctx := NewContext(context.Background(), &Identity{Username: "user"})
+	if username := UsernameFromContext(ctx); username != "user" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+}
+
+func TestWrapBasicIdentity(t *testing.T) {
+	ts := httptest.NewServer(NewHandlerWithAuth(basicAuth, http.HandlerFunc(identityHandler)))
+	defer ts.Close()
+
+	resp, err := http.Get("http://user:user@" + ts.URL[7:])
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Received incorrect status: %d", resp.StatusCode)
+	}
+
+	buffer, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	if string(buffer) != "Basic:golang:user" {
+		t.Errorf("Incorrect body text: %s", buffer)
+	}
+}
+
+func TestWrapCookieIdentity(t *testing.T) {
+	ts := httptest.NewServer(NewHandlerWithAuth(cookieAuth, http.HandlerFunc(identityHandler)))
+	defer ts.Close()
+
+	nonce, err := cookieAuth.createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: nonce})
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer resp.Body.Close()
+
+	buffer, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	if string(buffer) != "Cookie:golang:user1" {
+		t.Errorf("Incorrect body text: %s", buffer)
+	}
+}
@@ -5,10 +5,10 @@
 package httpauth
 
 import (
-	"container/heap"
 	"errors"
 	"html"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,42 +18,77 @@ import (
 var (
 	ErrBadUsernameOrPassword = errors.New("Bad username or password.")
 	ErrInvalidToken          = errors.New("The session token was invalid.")
+	ErrTooManySessions       = errors.New("The user has too many sessions.")
+	ErrSessionsNotStored     = errors.New("The sessions are not stored by the server.")
 )
 
-type cookieClientInfo struct {
-	username    string // username for this authorized connection
-	lastContact int64  // time of last communication with this client (unix nanoseconds)
-	nonce       string // unique per client salt
+// The constant DefaultCookieName contains the name of the cookie that holds
+// the session token, if no other name is set in the CookieOptions.
+const DefaultCookieName = "Authorization"
+
+// CookieOptions control the attributes of the cookie that holds the session
+// token.  The zero value creates a cookie named DefaultCookieName that can be
+// sent over HTTP and HTTPS, and that is deleted when the browser closes.
+type CookieOptions struct {
+	// Name is the name of the cookie.  If empty, DefaultCookieName is used.
+	Name string
+	// Domain sets the hosts to which the cookie is sent.  If empty, the
+	// cookie is only sent to the host that set it.
+	Domain string
+	// Secure restricts the cookie to HTTPS connections.
+	Secure bool
+	// SameSite restricts sending the cookie with cross-site requests.
+	SameSite http.SameSite
+	// MaxAge sets the lifetime of the cookie in seconds.  If zero, the
+	// cookie is deleted when the browser closes.
+	MaxAge int
+	// HostPrefix adds the prefix '__Host-' to the name of the cookie.
+	// Browsers only accept such cookies if they are secure, have the path
+	// '/', and have no domain, so these attributes are forced, and Domain
+	// and the path of the policy are ignored.
+	HostPrefix bool
 }
 
-type cookiePriorityQueue []*cookieClientInfo
-
-func (pq cookiePriorityQueue) Len() int {
-	return len(pq)
-}
-
-func (pq cookiePriorityQueue) Less(i, j int) bool {
-	return pq[i].lastContact < pq[j].lastContact
-}
-
-func (pq cookiePriorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-}
-
-func (pq *cookiePriorityQueue) Push(x interface{}) {
-	*pq = append(*pq, x.(*cookieClientInfo))
+// CookieName returns the name of the cookie, including any prefix.
+func (o *CookieOptions) CookieName() string {
+	name := o.Name
+	if name == "" {
+		name = DefaultCookieName
+	}
+	if o.HostPrefix {
+		return "__Host-" + name
+	}
+	return name
 }
 
-func (pq *cookiePriorityQueue) Pop() interface{} {
-	n := len(*pq)
-	ret := (*pq)[n-1]
-	*pq = (*pq)[:n-1]
-	return ret
+// NewCookie returns a cookie that holds the value, with the attributes set
+// by the options.  The cookie is HttpOnly, as there is no reason for
+// client-side code to access session tokens.
+func (o *CookieOptions) NewCookie(path, value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     o.CookieName(),
+		Value:    value,
+		Path:     path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: true,
+		SameSite: o.SameSite,
+	}
+	if o.HostPrefix {
+		cookie.Path, cookie.Domain, cookie.Secure = "/", "", true
+	}
+	return cookie
 }
 
-func (pq cookiePriorityQueue) MinValue() int64 {
-	n := len(pq)
-	return pq[n-1].lastContact
+// ExpiredCookie returns a cookie that deletes the cookie created by
+// NewCookie from the client.  The attributes must match for browsers to
+// delete the cookie.
+func (o *CookieOptions) ExpiredCookie(path string) *http.Cookie {
+	cookie := o.NewCookie(path, "")
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	return cookie
 }
 
 // A Cookie is a policy for authenticating users that uses a cookie stored
@@ -64,6 +99,13 @@ func (pq cookiePriorityQueue) MinValue() int64 {
 // When a user successfully logs in, a token (nonce) is saved in a cookie.
 // The presence and validity of that token is verified to authorize future
 // HTTP requests.  The tokens can also be invalidated to logout a users.
+//
+// By default, sessions are stored in memory, and so are lost when the
+// server restarts, and are not shared between replicas.  Sessions can be
+// kept elsewhere by replacing the SessionStore.  If SessionSecrets
+// or SessionCodec is set, the token instead holds the details of the
+// session, and is protected so that it can be verified without any state on
+// the server.
 type Cookie struct {
 	// Realm provides a 'namespace' where the authentication will be considered.
 	Realm string
@@ -71,18 +113,62 @@ type Cookie struct {
 	Auth Authenticator
 	// Clients are redirected to the LoginPage when they don't have authorization
 	LoginPage string
+	// ReturnToParam names the query parameter that NotifyAuthRequired adds
+	// to the LoginPage, holding the URL that the client requested.  See
+	// ReturnURL.  If empty, the URL is not added.
+	ReturnToParam string
+	// AllowedReturnHosts lists the hosts, other than the host of the
+	// request, to which clients can return after logging in.
+	AllowedReturnHosts []string
 	// Path sets the scope of the authorization cookie
 	Path string
-	// RequireXsrfHeader adds an additional verification.  See function VerifyXsrfHeader.
+	// CookieOptions sets the other attributes of the authorization cookie.
+	CookieOptions CookieOptions
+	// RequireXsrfHeader adds an additional verification.  See function
+	// VerifyXsrfHeader, and the stronger protection of RequireCsrfToken.
 	RequireXsrfHeader bool
+	// IsAPIRequest identifies requests made by scripts or other API clients,
+	// in addition to those that accept JSON or have the header
+	// X-Xsrf-Cookie.  API clients that lack authorization receive a 401
+	// response with a JSON body, instead of a redirection to the LoginPage.
+	IsAPIRequest func(r *http.Request) bool
 
 	// CientCacheResidence controls how long client information is retained
 	ClientCacheResidence time.Duration
-
-	mutex          sync.Mutex
-	clientsByNonce map[string]*cookieClientInfo
-	clientsByUser  map[string]*cookieClientInfo
-	lru            cookiePriorityQueue
+	// SessionLifetime limits how long a session can be used after login,
+	// however active the client is.  Afterwards, the user must login again.
+	// The cookie is set to expire at the same time.  If zero, the lifetime
+	// of sessions is not limited.
+	SessionLifetime time.Duration
+	// Sessions holds the sessions of clients that have logged in.
+	Sessions SessionStore
+	// MaxSessions limits the number of concurrent sessions for each user.
+	// If zero, the number of sessions is not limited.  The limit does not
+	// apply to stateless sessions.  Logins through this policy are
+	// serialized to enforce the limit, but replicas sharing a store are not
+	// coordinated.
+	MaxSessions int
+	// RejectExcessSessions controls what happens when a user with
+	// MaxSessions sessions logs in.  If true, the login fails with the error
+	// ErrTooManySessions.  Otherwise, the oldest sessions are removed.
+	RejectExcessSessions bool
+	// SessionSecrets enables stateless sessions when not empty.  Tokens
+	// encode the username and the time of login, and are signed using the
+	// first secret.  Tokens signed using any of the secrets are accepted, so
+	// that secrets can be rotated.  Stateless sessions expire
+	// SessionLifetime after login, or ClientCacheResidence if
+	// SessionLifetime is zero.
+	SessionSecrets [][]byte
+	// SessionCodec enables stateless sessions when not nil, and protects the
+	// tokens in place of SessionSecrets.  Use NewAEADCodec so that the
+	// contents of the tokens are hidden from clients.
+	SessionCodec SessionCodec
+	// Revoked records stateless sessions that have been logged out.  If nil,
+	// Logout only clears the cookie, and the token remains valid until it
+	// expires.
+	Revoked RevocationList
+
+	mutex sync.Mutex // held while checking MaxSessions and creating a session
 }
 
 // NewCookie creates a new authentication policy that uses the cookie authentication scheme.
@@ -91,25 +177,21 @@ func NewCookie(realm, loginPageUrl string, auth Authenticator) *Cookie {
 		realm,
 		auth,
 		loginPageUrl,
+		DefaultReturnToParam,
+		nil,
 		"/",
+		CookieOptions{},
 		false,
+		nil,
 		DefaultClientCacheResidence,
-		sync.Mutex{},
-		make(map[string]*cookieClientInfo),
-		make(map[string]*cookieClientInfo),
-		nil}
-}
-
-func (a *Cookie) evictLeastRecentlySeen() {
-	now := time.Now().UnixNano()
-
-	// Remove all entries from the client cache older than the
-	// residence time.
-	for len(a.lru) > 0 && a.lru.MinValue()+a.ClientCacheResidence.Nanoseconds() <= now {
-		client := heap.Pop(&a.lru).(*cookieClientInfo)
-		delete(a.clientsByNonce, client.nonce)
-		delete(a.clientsByUser, client.username)
-	}
+		0,
+		NewMemoryStore(),
+		0,
+		false,
+		nil,
+		nil,
+		nil,
+		sync.Mutex{}}
 }
 
 // Authorize retrieves the credientials from the HTTP request, and
@@ -123,24 +205,29 @@ func (a *Cookie) Authorize(r *http.Request) (username string) {
 	}
 
 	// Find the nonce used to identify a client
-	token, err := r.Cookie("Authorization")
+	token, err := r.Cookie(a.CookieOptions.CookieName())
 	if err != nil || token.Value == "" {
 		return ""
 	}
-	if len(token.Value) != nonceLen {
+	if a.stateless() {
+		if session, ok := a.verifySession(token.Value); ok {
+			return session.username
+		}
 		return ""
 	}
 
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
 	// Do we have a client with that nonce?
-	if client, ok := a.clientsByNonce[token.Value]; ok {
-		client.lastContact = time.Now().UnixNano()
-		return client.username
+	session, err := a.Sessions.Lookup(token.Value)
+	if err != nil || session == nil {
+		return ""
+	}
+	if a.SessionLifetime > 0 && time.Since(session.Created) >= a.SessionLifetime {
+		// The session is too old, whether or not it is idle.  Errors are
+		// ignored, as the session will also be removed by eviction.
+		a.Sessions.Delete(session.ID)
+		return ""
 	}
-	return ""
+	return session.Username
 }
 
 // NotifyAuthRequired adds the headers to the HTTP response to
@@ -148,27 +235,49 @@ func (a *Cookie) Authorize(r *http.Request) (username string) {
 // must be used to gain authentication.
 //
 // Caller's should consider adding sending an HTML response with a link
-// to the login page for GET requests.
+// to the login page for GET requests.  For GET requests, the URL of the
+// request is attached to the login page, so that the client can return
+// after logging in.
+//
+// API clients, including those identified by IsAPIRequest, are not
+// redirected.  Instead, they receive a 401 response with a JSON problem
+// body, as described by RFC 7807, that includes the URL of the login page.
 func (a *Cookie) NotifyAuthRequired(w http.ResponseWriter, r *http.Request) {
-	// This code is derived from http.Redirect
-	w.Header().Set("Location", a.LoginPage)
-	w.WriteHeader(http.StatusTemporaryRedirect)
-
-	// RFC2616 recommends that a short note "SHOULD" be included in the
-	// response because older user agents may not understand 301/307.
-	// Shouldn't send the response for POST or HEAD; that leaves GET.
-	if r.Method == "GET" {
-		note := "<a href=\"" + html.EscapeString(a.LoginPage) + "\">" + http.StatusText(http.StatusTemporaryRedirect) + "</a>.\n"
-		w.Write([]byte(note))
+	loginPage := a.loginPageURL(r)
+
+	if a.isAPIRequest(r) {
+		w.Header().Set("WWW-Authenticate", "Cookie realm="+quoteString(a.Realm)+", login="+quoteString(loginPage))
+		writeProblem(w, &problem{
+			Status:   http.StatusUnauthorized,
+			Detail:   "Authentication is required.",
+			Instance: r.URL.RequestURI(),
+			Login:    loginPage,
+		})
+	} else {
+		// This code is derived from http.Redirect
+		w.Header().Set("Location", loginPage)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+
+		// RFC2616 recommends that a short note "SHOULD" be included in the
+		// response because older user agents may not understand 301/307.
+		// Shouldn't send the response for POST or HEAD; that leaves GET.
+		if r.Method == "GET" {
+			note := "<a href=\"" + html.EscapeString(loginPage) + "\">" + http.StatusText(http.StatusTemporaryRedirect) + "</a>.\n"
+			w.Write([]byte(note))
+		}
 	}
 
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// Check for old clientInfo, and evict those older than
-	// residence time.
-	a.evictLeastRecentlySeen()
+	// Check for old sessions, and evict those idle for longer than
+	// residence time, or older than their lifetime.  Errors are ignored, as
+	// the eviction will be retried.
+	if !a.stateless() {
+		now := time.Now()
+		var createdBefore time.Time
+		if a.SessionLifetime > 0 {
+			createdBefore = now.Add(-a.SessionLifetime)
+		}
+		a.Sessions.Expire(now.Add(-a.ClientCacheResidence), createdBefore)
+	}
 }
 
 // The function createSession checks the credentials of a client, and, if
@@ -186,27 +295,47 @@ func (a *Cookie) createSession(username, password string) (nonce string, err err
 		return "", ErrBadUsernameOrPassword
 	}
 
-	// Create an entry for this user
-	nonce, err = createNonce()
-	if err != nil {
-		return "", err
+	// Stateless sessions are not recorded
+	if a.stateless() {
+		now := time.Now()
+		session, err := newSessionToken(username, now, now.Add(a.statelessLifetime()))
+		if err != nil {
+			return "", err
+		}
+		return a.encodeSession(session)
 	}
 
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// Check if there is already a session for this username
-	if ci, ok := a.clientsByUser[username]; ok {
-		ci.lastContact = time.Now().UnixNano()
-		return ci.nonce, nil
+	// Enforce the limit on concurrent sessions for this username.  The lock
+	// is held until the session is created, so that concurrent logins
+	// cannot exceed the limit.
+	if a.MaxSessions > 0 {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		sessions, err := a.Sessions.List(username)
+		if err != nil {
+			return "", err
+		}
+		if len(sessions) >= a.MaxSessions {
+			if a.RejectExcessSessions {
+				return "", ErrTooManySessions
+			}
+			// Sessions are listed from oldest to newest
+			for _, v := range sessions[:len(sessions)-a.MaxSessions+1] {
+				if err := a.Sessions.Delete(v.ID); err != nil {
+					return "", err
+				}
+			}
+		}
 	}
 
-	ci := &cookieClientInfo{username, time.Now().UnixNano(), nonce}
-	a.clientsByNonce[nonce] = ci
-	a.clientsByUser[username] = ci
-
-	return nonce, nil
+	// Create an entry for this client.  Each client gets its own session,
+	// so that logging out on one device does not affect the others.
+	session, err := a.Sessions.Create(username)
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
 }
 
 // Login checks the credentials (a username/password pair) of the client.
@@ -218,6 +347,9 @@ func (a *Cookie) createSession(username, password string) (nonce string, err err
 // the HTTP request. For successful validation, redirection (http.StatusTemporaryRedirect)
 // to the protected content is most likely the correct response.
 //
+// A new token is issued for every login, so a token planted on the client
+// before the login (session fixation) does not gain access.
+//
 // If the credentials cannot be verified, an error (ErrBadUsernameOrPassword)
 // is returned.  Other errors are possible.  The caller is then responsable
 // for creating an appropriate reponse to the HTTP request.
@@ -227,29 +359,268 @@ func (a *Cookie) Login(w http.ResponseWriter, username, password string) error {
 		return err
 	}
 
+	var expires time.Time
+	if a.SessionLifetime > 0 {
+		expires = time.Now().Add(a.SessionLifetime)
+	}
+	a.setCookie(w, nonce, expires)
+	return nil
+}
+
+// Regenerate issues a new token for the session associated with the HTTP
+// request, and sets the cookie on the HTTP response.  The session is
+// otherwise unchanged, but the old token is no longer valid.  Callers
+// should regenerate the token whenever the privileges of the session
+// change.
+//
+// For stateless sessions, the old token is only invalidated if Revoked is
+// set.  If the request does not have a valid session, the error
+// ErrInvalidToken is returned.
+func (a *Cookie) Regenerate(w http.ResponseWriter, r *http.Request) error {
+	// If the session was loaded by LoadSession, the loaded session is
+	// regenerated, as the token in the request may already be stale
+	data := a.loadedSession(r)
+	var current string
+	if data == nil {
+		token, err := r.Cookie(a.CookieOptions.CookieName())
+		if err != nil || token.Value == "" {
+			return ErrInvalidToken
+		}
+		current = token.Value
+	}
+
+	var nonce string
+	var expires time.Time
+	if a.stateless() {
+		var session sessionToken
+		var ok bool
+		if data != nil {
+			if session, ok = data.statelessSession(); ok {
+				session.values, session.flashes, _ = data.snapshot()
+			}
+		} else {
+			session, ok = a.verifySession(current)
+		}
+		if !ok {
+			return ErrInvalidToken
+		}
+		updated, err := a.regenerateSessionToken(session)
+		if err != nil {
+			return err
+		}
+		if nonce, err = a.encodeSession(updated); err != nil {
+			return err
+		}
+		if a.Revoked != nil {
+			a.Revoked.Revoke(session.sessionID(), session.expires)
+		}
+		if data != nil {
+			data.setSession(nil, &updated)
+		}
+		expires = session.expires
+	} else {
+		if data != nil {
+			session := data.storedSession()
+			if session == nil {
+				return ErrInvalidToken
+			}
+			current = session.ID
+		}
+		session, err := a.Sessions.Regenerate(current)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return ErrInvalidToken
+		}
+		if data != nil {
+			data.setSession(session, nil)
+		}
+		nonce = session.ID
+		expires = session.Created.Add(a.SessionLifetime)
+	}
+
+	if a.SessionLifetime <= 0 {
+		expires = time.Time{}
+	}
+	a.setCookie(w, nonce, expires)
+	return nil
+}
+
+// The function regenerateSessionToken creates a token for a stateless
+// session with a new ID, but with the same details.
+func (a *Cookie) regenerateSessionToken(session sessionToken) (sessionToken, error) {
+	updated, err := newSessionToken(session.username, session.issued, session.expires)
+	if err != nil {
+		return sessionToken{}, err
+	}
+	updated.values, updated.flashes = session.values, session.flashes
+	return updated, nil
+}
+
+// The function encodeSession returns the token for a stateless session.
+func (a *Cookie) encodeSession(session sessionToken) (string, error) {
+	data, err := session.marshal()
+	if err != nil {
+		return "", err
+	}
+	return a.codec().Encode(a.Realm, data)
+}
+
+// The function setCookie sets the cookie that holds the session token on
+// the HTTP response.  If expires is not zero, the cookie will expire no
+// later than that time.
+func (a *Cookie) setCookie(w http.ResponseWriter, nonce string, expires time.Time) {
 	// There is no reason for client-side code to access the nonce.  Therefore,
-	// we will set the cookie as HttpOnly.
-	// We should also consider setting the cookie as secure, and restrict
-	// it to HTTPS connections.  However, some library users might be
-	// using HTTP, and the nonce should (at minimum) be safe against
-	// replay attacks.
-	http.SetCookie(w, &http.Cookie{Name: "Authorization", Value: nonce, Path: a.Path, HttpOnly: true})
+	// the cookie is always HttpOnly.  The cookie is only secure if requested
+	// in the options, as some library users might be using HTTP, and the
+	// nonce should (at minimum) be safe against replay attacks.
+	cookie := a.CookieOptions.NewCookie(a.Path, nonce)
+	if !expires.IsZero() {
+		maxAge := int(time.Until(expires) / time.Second)
+		if maxAge < 1 {
+			maxAge = 1
+		}
+		if cookie.MaxAge == 0 || maxAge < cookie.MaxAge {
+			cookie.MaxAge = maxAge
+		}
+	}
+
+	// Replace any token already set on the response, such as when the
+	// session is regenerated and then its data is saved
+	headers := w.Header()["Set-Cookie"][:0]
+	for _, v := range w.Header()["Set-Cookie"] {
+		if !strings.HasPrefix(v, cookie.Name+"=") {
+			headers = append(headers, v)
+		}
+	}
+	w.Header()["Set-Cookie"] = headers
+	http.SetCookie(w, cookie)
+}
+
+// The function isAPIRequest returns whether or not the request was made by
+// an API client, which should not be redirected to the login page.
+func (a *Cookie) isAPIRequest(r *http.Request) bool {
+	if VerifyXsrfHeader(r) || acceptsJSON(r) {
+		return true
+	}
+	return a.IsAPIRequest != nil && a.IsAPIRequest(r)
+}
+
+// The function statelessLifetime returns how long stateless sessions can
+// be used after login.
+func (a *Cookie) statelessLifetime() time.Duration {
+	if a.SessionLifetime > 0 {
+		return a.SessionLifetime
+	}
+	return a.ClientCacheResidence
+}
+
+// The function stateless returns whether or not sessions are stored in the
+// cookies instead of on the server.
+func (a *Cookie) stateless() bool {
+	return a.SessionCodec != nil || len(a.SessionSecrets) != 0
+}
+
+// The function codec returns the codec used to protect the tokens of
+// stateless sessions.
+func (a *Cookie) codec() SessionCodec {
+	if a.SessionCodec != nil {
+		return a.SessionCodec
+	}
+	return &signedCodec{a.SessionSecrets}
+}
+
+// The function decodeSession returns the details of a stateless session
+// from its token, without checking whether the session is still valid.
+func (a *Cookie) decodeSession(token string) (sessionToken, bool) {
+	if !a.stateless() {
+		return sessionToken{}, false
+	}
+	data, err := a.codec().Decode(a.Realm, token)
+	if err != nil {
+		return sessionToken{}, false
+	}
+	return unmarshalSessionToken(data)
+}
+
+// The function verifySession checks the token for a stateless session, and
+// returns the details of the session if it is still valid.
+func (a *Cookie) verifySession(token string) (sessionToken, bool) {
+	session, ok := a.decodeSession(token)
+	if !ok || !time.Now().Before(session.expires) {
+		return sessionToken{}, false
+	}
+	if a.Revoked != nil && a.Revoked.IsRevoked(session.sessionID()) {
+		return sessionToken{}, false
+	}
+	return session, true
+}
+
+// The function destroyLoadedSession removes the session loaded by
+// LoadSession, and marks the session data so that it is not saved.
+func (a *Cookie) destroyLoadedSession(data *SessionData) error {
+	session := data.storedSession()
+	token, ok := data.statelessSession()
+	data.setSession(nil, nil)
+
+	switch {
+	case ok && a.Revoked != nil:
+		a.Revoked.Revoke(token.sessionID(), token.expires)
+	case session != nil:
+		return a.Sessions.Delete(session.ID)
+	}
 	return nil
 }
 
 // The function destroySession ensures that the nonce is no longer valid.
-func (a *Cookie) destroySession(nonce string) {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+// Stateless sessions can only be invalidated if Revoked is set.
+func (a *Cookie) destroySession(nonce string) error {
+	if a.stateless() {
+		if session, ok := a.verifySession(nonce); ok && a.Revoked != nil {
+			a.Revoked.Revoke(session.sessionID(), session.expires)
+		}
+		return nil
+	}
 
-	// Do we have a client with that nonce?
-	if client, ok := a.clientsByNonce[nonce]; ok {
-		// remove client info from maps
-		delete(a.clientsByNonce, nonce)
-		delete(a.clientsByUser, client.username)
-		// client info is still in the priority queue
-		// however, it will be removed in due time when it expires
+	return a.Sessions.Delete(nonce)
+}
+
+// ListSessions returns the sessions of the user, ordered from oldest to
+// newest.  The IDs of the sessions are the tokens stored in the clients'
+// cookies, so they should not be disclosed to other users.  Stateless
+// sessions cannot be listed, and the error ErrSessionsNotStored is
+// returned.
+func (a *Cookie) ListSessions(username string) ([]*Session, error) {
+	if a.stateless() {
+		return nil, ErrSessionsNotStored
+	}
+	return a.Sessions.List(username)
+}
+
+// RevokeSession ends a single session, such as one returned by ListSessions.
+// For stateless sessions, the ID is the SessionID of the client's Identity,
+// and the session can only be revoked if Revoked is set.
+func (a *Cookie) RevokeSession(id string) error {
+	if a.stateless() {
+		if a.Revoked == nil {
+			return ErrSessionsNotStored
+		}
+		// The session cannot be older than its maximum lifetime
+		a.Revoked.Revoke(id, time.Now().Add(a.statelessLifetime()))
+		return nil
 	}
+	return a.Sessions.Delete(id)
+}
+
+// RevokeSessions ends all of the sessions of the user, for example after a
+// change of password.  Stateless sessions cannot be revoked by user, and the
+// error ErrSessionsNotStored is returned.
+func (a *Cookie) RevokeSessions(username string) error {
+	if a.stateless() {
+		return ErrSessionsNotStored
+	}
+	return a.Sessions.DeleteUser(username)
 }
 
 // Logout ensures that the session associated with the HTTP request
@@ -266,14 +637,18 @@ func (a *Cookie) destroySession(nonce string) {
 // returned.  The caller is then responsable for creating an appropriate reponse to
 // the HTTP request.
 func (a *Cookie) Logout(w http.ResponseWriter, r *http.Request) error {
-	// Find the nonce used to identify a client
-	token, err := r.Cookie("Authorization")
-	if err == nil || token.Value != "" {
+	var err error
+	if data := a.loadedSession(r); data != nil {
+		// The session was loaded by LoadSession, and may have been
+		// regenerated.  It must not be saved once the handler returns.
+		err = a.destroyLoadedSession(data)
+	} else if token, cerr := r.Cookie(a.CookieOptions.CookieName()); cerr == nil && token.Value != "" {
 		// Invalidate the nonce
-		a.destroySession(token.Value)
+		err = a.destroySession(token.Value)
 	}
 
-	// Clear the cookie from the client
-	http.SetCookie(w, &http.Cookie{Name: "Authorization", Value: "", Path: a.Path, Expires: time.Unix(0, 0)})
-	return nil
+	// Clear the cookie from the client, even if the session could not be
+	// removed from the store
+	http.SetCookie(w, a.CookieOptions.ExpiredCookie(a.Path))
+	return err
 }
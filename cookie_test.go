@@ -5,11 +5,15 @@
 package httpauth
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -58,7 +62,7 @@ func TestCookieNoAuth(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("Received incorrect status: %d", resp.StatusCode)
 	}
-	if resp.Request.URL.String() != ts.URL+"/cookie/login/" {
+	if resp.Request.URL.String() != ts.URL+"/cookie/login/?return_to=%2Fcookie%2F" {
 		t.Errorf("Received incorrect page: %s", resp.Request.URL.String())
 	}
 
@@ -84,9 +88,102 @@ func TestCookieCreateSession(t *testing.T) {
 		t.Fatalf("Error:  %s", err)
 	}
 
-	if nonce1 != nonce2 {
+	// Each login gets its own session
+	if nonce1 == nonce2 {
 		t.Errorf("Error when login twice using the same username.")
 	}
+	for _, nonce := range []string{nonce1, nonce2} {
+		if session, _ := cookieAuth.Sessions.Lookup(nonce); session == nil || session.Username != "user1" {
+			t.Errorf("Incorrect session: %v", session)
+		}
+	}
+}
+
+func TestCookieMaxSessions(t *testing.T) {
+	policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+		return realm == "golang" && username == password
+	})
+	policy.MaxSessions = 2
+
+	var nonces []string
+	for i := 0; i < 3; i++ {
+		nonce, err := policy.createSession("user1", "user1")
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		nonces = append(nonces, nonce)
+	}
+
+	// The oldest session was removed
+	sessions, err := policy.ListSessions("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != nonces[1] || sessions[1].ID != nonces[2] {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+
+	// Further logins are rejected
+	policy.RejectExcessSessions = true
+	if _, err := policy.createSession("user1", "user1"); err != ErrTooManySessions {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if _, err := policy.createSession("user2", "user2"); err != nil {
+		t.Errorf("Error:  %s", err)
+	}
+
+	// Revoke a single session, and then all of them
+	if err := policy.RevokeSession(nonces[1]); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if sessions, _ := policy.ListSessions("user1"); len(sessions) != 1 || sessions[0].ID != nonces[2] {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+	if err := policy.RevokeSessions("user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if sessions, _ := policy.ListSessions("user1"); len(sessions) != 0 {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+	if sessions, _ := policy.ListSessions("user2"); len(sessions) != 1 {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+}
+
+// A slowListStore delays List, so that concurrent logins interleave.
+type slowListStore struct {
+	SessionStore
+}
+
+func (s slowListStore) List(username string) ([]*Session, error) {
+	sessions, err := s.SessionStore.List(username)
+	time.Sleep(time.Millisecond)
+	return sessions, err
+}
+
+func TestCookieMaxSessionsConcurrent(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return username == password
+		})
+		policy.MaxSessions = 2
+		policy.RejectExcessSessions = reject
+		policy.Sessions = slowListStore{policy.Sessions}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				policy.createSession("user1", "user1")
+			}()
+		}
+		wg.Wait()
+
+		if sessions, _ := policy.ListSessions("user1"); len(sessions) != 2 {
+			t.Errorf("Incorrect number of sessions: %d", len(sessions))
+		}
+	}
 }
 
 func TestCookieDestroySession(t *testing.T) {
@@ -175,3 +272,316 @@ func TestCookieLogout(t *testing.T) {
 	}
 
 }
+
+func TestCookieStateless(t *testing.T) {
+	newPolicy := func(secrets ...string) *Cookie {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		for _, v := range secrets {
+			policy.SessionSecrets = append(policy.SessionSecrets, []byte(v))
+		}
+		return policy
+	}
+	request := func(token string) *http.Request {
+		r := httptest.NewRequest("GET", "/cookie/", nil)
+		r.AddCookie(&http.Cookie{Name: "Authorization", Value: token})
+		return r
+	}
+
+	policy := newPolicy("secret1")
+	token1, err := policy.createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	token2, err := policy.createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if token1 == token2 {
+		t.Errorf("Tokens are not unique.")
+	}
+
+	// A replica that shares the secret accepts the token, including after
+	// the secret has been rotated
+	if username := newPolicy("secret1").Authorize(request(token1)); username != "user1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+	if username := newPolicy("secret2", "secret1").Authorize(request(token1)); username != "user1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+	if username := newPolicy("secret2").Authorize(request(token1)); username != "" {
+		t.Errorf("Accepted token signed with an unknown secret.")
+	}
+	if username := newPolicy().Authorize(request(token1)); username != "" {
+		t.Errorf("Accepted token without stateless sessions.")
+	}
+
+	// Tampered tokens are rejected
+	forged := []byte(token1)
+	forged[len(forged)/2] ^= 1
+	if username := policy.Authorize(request(string(forged))); username != "" {
+		t.Errorf("Accepted forged token.")
+	}
+
+	// Identities use the session ID, not the token
+	id1 := policy.Identify(request(token1), "user1")
+	id2 := policy.Identify(request(token2), "user1")
+	if id1.SessionID == "" || id1.SessionID == token1 || id1.SessionID == id2.SessionID {
+		t.Errorf("Incorrect session ID: %s", id1.SessionID)
+	}
+
+	// Expired tokens are rejected
+	policy.ClientCacheResidence = -time.Second
+	expired, err := policy.createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if username := policy.Authorize(request(expired)); username != "" {
+		t.Errorf("Accepted expired token.")
+	}
+
+	// Without a revocation list, logout only clears the cookie
+	if err := policy.Logout(httptest.NewRecorder(), request(token1)); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if username := policy.Authorize(request(token1)); username != "user1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	// With a revocation list, only the session that logged out is rejected
+	policy.Revoked = NewRevocationList()
+	if err := policy.Logout(httptest.NewRecorder(), request(token1)); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if username := policy.Authorize(request(token1)); username != "" {
+		t.Errorf("Accepted revoked token.")
+	}
+	if username := policy.Authorize(request(token2)); username != "user1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	// Sessions can be revoked using the ID from the identity
+	if err := policy.RevokeSession(id2.SessionID); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if username := policy.Authorize(request(token2)); username != "" {
+		t.Errorf("Accepted revoked token.")
+	}
+	if _, err := policy.ListSessions("user1"); err != ErrSessionsNotStored {
+		t.Errorf("Incorrect error: %v", err)
+	}
+}
+
+func TestCookieLogoutWithoutCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := cookieAuth.Logout(w, httptest.NewRequest("GET", "/cookie/", nil)); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); cookie == "" {
+		t.Errorf("Cookie was not cleared.")
+	}
+}
+
+func TestCookieRegenerate(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		if stateless {
+			policy.SessionSecrets = [][]byte{[]byte("secret")}
+			policy.Revoked = NewRevocationList()
+		}
+		request := func(token string) *http.Request {
+			r := httptest.NewRequest("GET", "/cookie/", nil)
+			r.AddCookie(&http.Cookie{Name: "Authorization", Value: token})
+			return r
+		}
+
+		old, err := policy.createSession("user1", "user1")
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		w := httptest.NewRecorder()
+		if err := policy.Regenerate(w, request(old)); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value == old {
+			t.Fatalf("Incorrect cookies: %v", cookies)
+		}
+
+		if username := policy.Authorize(request(cookies[0].Value)); username != "user1" {
+			t.Errorf("Incorrect username: %s", username)
+		}
+		if username := policy.Authorize(request(old)); username != "" {
+			t.Errorf("Accepted old token (stateless %v).", stateless)
+		}
+		if err := policy.Regenerate(httptest.NewRecorder(), request(old)); err != ErrInvalidToken {
+			t.Errorf("Incorrect error: %v", err)
+		}
+	}
+}
+
+func TestCookieOptions(t *testing.T) {
+	policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+		return realm == "golang" && username == password
+	})
+	policy.Path = "/app/"
+	policy.CookieOptions = CookieOptions{Name: "session", Domain: "example.com", SameSite: http.SameSiteStrictMode, MaxAge: 3600}
+
+	w := httptest.NewRecorder()
+	if err := policy.Login(w, "user1", "user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "session=") ||
+		!strings.Contains(cookie, "; Path=/app/; Domain=example.com; Max-Age=3600; HttpOnly; SameSite=Strict") {
+		t.Errorf("Incorrect cookie: %s", cookie)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/app/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: cookie.Value})
+	if username := policy.Authorize(r); username != "user1" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+	r = httptest.NewRequest("GET", "/app/", nil)
+	r.AddCookie(&http.Cookie{Name: "Authorization", Value: cookie.Value})
+	if username := policy.Authorize(r); username != "" {
+		t.Errorf("Accepted cookie with the wrong name.")
+	}
+
+	// The prefix forces the attributes required by browsers
+	policy.CookieOptions.HostPrefix = true
+	w = httptest.NewRecorder()
+	if err := policy.Login(w, "user1", "user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "__Host-session=") ||
+		!strings.Contains(cookie, "; Path=/; Max-Age=3600; HttpOnly; Secure; SameSite=Strict") {
+		t.Errorf("Incorrect cookie: %s", cookie)
+	}
+
+	// Logout uses the same attributes
+	w = httptest.NewRecorder()
+	if err := policy.Logout(w, httptest.NewRequest("GET", "/app/", nil)); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "__Host-session=;") ||
+		!strings.Contains(cookie, "; Path=/; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0; HttpOnly; Secure; SameSite=Strict") {
+		t.Errorf("Incorrect cookie: %s", cookie)
+	}
+}
+
+func TestCookieSessionLifetime(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		if stateless {
+			policy.SessionSecrets = [][]byte{[]byte("secret")}
+		}
+		policy.SessionLifetime = 100 * time.Millisecond
+
+		w := httptest.NewRecorder()
+		if err := policy.Login(w, "user1", "user1"); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		cookie := w.Result().Cookies()[0]
+		if cookie.MaxAge != 1 {
+			t.Errorf("Incorrect cookie expiry: %d", cookie.MaxAge)
+		}
+
+		r := httptest.NewRequest("GET", "/cookie/", nil)
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		if username := policy.Authorize(r); username != "user1" {
+			t.Errorf("Incorrect username: %s", username)
+		}
+
+		// The session expires even though it is being used
+		time.Sleep(150 * time.Millisecond)
+		if username := policy.Authorize(r); username != "" {
+			t.Errorf("Accepted expired session (stateless %v).", stateless)
+		}
+	}
+
+	// The cookie expiry is the sooner of the lifetime and MaxAge
+	policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+		return realm == "golang" && username == password
+	})
+	policy.SessionLifetime = 8 * time.Hour
+	policy.CookieOptions.MaxAge = 3600
+	w := httptest.NewRecorder()
+	if err := policy.Login(w, "user1", "user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Result().Cookies()[0]; cookie.MaxAge != 3600 {
+		t.Errorf("Incorrect cookie expiry: %d", cookie.MaxAge)
+	}
+	policy.CookieOptions.MaxAge = 0
+	w = httptest.NewRecorder()
+	if err := policy.Login(w, "user1", "user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if cookie := w.Result().Cookies()[0]; cookie.MaxAge < 8*3600-5 || cookie.MaxAge > 8*3600 {
+		t.Errorf("Incorrect cookie expiry: %d", cookie.MaxAge)
+	}
+}
+
+func TestCookieAPIRequest(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	policy.IsAPIRequest = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	}
+
+	cases := []struct {
+		target string
+		header string
+		value  string
+		api    bool
+	}{
+		{"/page", "Accept", "text/html,*/*;q=0.8", false},
+		{"/page", "Accept", "application/json", true},
+		{"/page", "X-Xsrf-Cookie", "1", true},
+		{"/api/items", "", "", true},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("GET", v.target, nil)
+		if v.header != "" {
+			r.Header.Set(v.header, v.value)
+		}
+		w := httptest.NewRecorder()
+		policy.NotifyAuthRequired(w, r)
+
+		if !v.api {
+			if w.Code != http.StatusTemporaryRedirect {
+				t.Errorf("Case %d:  Unexpected status code, got %d", i, w.Code)
+			}
+			continue
+		}
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Case %d:  Unexpected status code, got %d", i, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("Case %d:  Unexpected content type, got %s", i, ct)
+		}
+		if auth := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(auth, `Cookie realm="golang"`) {
+			t.Errorf("Case %d:  Unexpected challenge, got %s", i, auth)
+		}
+		if w.Header().Get("Location") != "" {
+			t.Errorf("Case %d:  Unexpected redirection", i)
+		}
+
+		var p problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		if p.Status != http.StatusUnauthorized || p.Title != "Unauthorized" || p.Instance != v.target || !strings.HasPrefix(p.Login, "/login?return_to=") {
+			t.Errorf("Case %d:  Unexpected problem, got %+v", i, p)
+		}
+	}
+}
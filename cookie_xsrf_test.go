@@ -53,7 +53,7 @@ func TestCookieXsrfNoAuth(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("Received incorrect status: %d", resp.StatusCode)
 	}
-	if resp.Request.URL.String() != ts.URL+"/cookie/login/" {
+	if resp.Request.URL.String() != ts.URL+"/cookie/login/?return_to=%2Fcookie%2F" {
 		t.Errorf("Received incorrect page: %s", resp.Request.URL.String())
 	}
 
@@ -92,7 +92,7 @@ func TestCookieXsrfMissingHeader(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("Received incorrect status: %d", resp.StatusCode)
 	}
-	if resp.Request.URL.String() != ts.URL+"/cookie/login/" {
+	if resp.Request.URL.String() != ts.URL+"/cookie/login/?return_to=%2Fcookie%2F" {
 		t.Errorf("Received incorrect page: %s", resp.Request.URL.String())
 	}
 
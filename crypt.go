@@ -0,0 +1,392 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The alphabet used by crypt(3) to encode hashes and salts.
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// The following constants name the formats that can be used to hash
+// passwords stored in htpasswd files.  HashCrypt only uses the first 8
+// characters of a password, and should not be used for new passwords.
+const (
+	HashBcrypt = "bcrypt"
+	HashAPR1   = "apr1"
+	HashSHA1   = "sha1"
+	HashCrypt  = "crypt"
+	HashPlain  = "plain"
+)
+
+// The following variables are used to specify error conditions when
+// hashing passwords.
+var (
+	ErrUnknownHashFormat = errors.New("The password hash format is not supported.")
+	ErrAmbiguousPassword = errors.New("The password cannot be stored as plain text, as it would be mistaken for a hash.")
+)
+
+// HashPassword hashes the password using the specified format, for storage
+// in an htpasswd file.  A new random salt is used.  For bcrypt, the default
+// cost is used.  Passwords that are empty, or that have the form of a hash,
+// cannot be stored as plain text.
+func HashPassword(password, format string) (string, error) {
+	switch format {
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		// Use the same prefix as Apache's htpasswd
+		return "$2y$" + string(hash[4:]), nil
+	case HashAPR1:
+		salt, err := createSalt(8)
+		if err != nil {
+			return "", err
+		}
+		return md5Crypt(password, salt, "$apr1$"), nil
+	case HashSHA1:
+		sum := sha1.Sum([]byte(password))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(sum[:]), nil
+	case HashCrypt:
+		salt, err := createSalt(2)
+		if err != nil {
+			return "", err
+		}
+		return desCrypt(password, salt), nil
+	case HashPlain:
+		if !isPlainPassword(password) {
+			return "", ErrAmbiguousPassword
+		}
+		return password, nil
+	}
+	return "", ErrUnknownHashFormat
+}
+
+func createSalt(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	for i := range buffer {
+		buffer[i] = itoa64[buffer[i]&0x3f]
+	}
+	return string(buffer), nil
+}
+
+// The function verifyPasswordHash checks the password against a hash
+// stored in an htpasswd file.  The following formats are recognized:
+// bcrypt ($2y$, $2a$, $2b$), Apache's MD5 ($apr1$), MD5-crypt ($1$),
+// SHA-1 ({SHA}), and the traditional DES-based crypt(3).  Other values are
+// compared with the password as plain text, unless they could be a hash in
+// an unsupported format, such as SHA-crypt ($5$ or $6$), in which case the
+// password is rejected.
+func verifyPasswordHash(hash, password string) bool {
+	var computed string
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		computed = md5Crypt(password, hash[len("$apr1$"):], "$apr1$")
+	case strings.HasPrefix(hash, "$1$"):
+		computed = md5Crypt(password, hash[len("$1$"):], "$1$")
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case isDesCryptHash(hash):
+		computed = desCrypt(password, hash[0:2])
+	case isPlainPassword(hash):
+		computed = password
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// The function isDesCryptHash returns whether the value has the form of
+// a hash created by the traditional crypt(3).
+func isDesCryptHash(hash string) bool {
+	if len(hash) != 13 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if strings.IndexByte(itoa64, hash[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// The function isPlainPassword returns whether the value can be stored in
+// an htpasswd file as plain text, without being mistaken for a hash.
+func isPlainPassword(value string) bool {
+	if value == "" || strings.HasPrefix(value, "$") || strings.HasPrefix(value, "{") {
+		return false
+	}
+	return !isDesCryptHash(value)
+}
+
+func to64(v uint32, n int) string {
+	var ret []byte
+	for ; n > 0; n-- {
+		ret = append(ret, itoa64[v&0x3f])
+		v >>= 6
+	}
+	return string(ret)
+}
+
+// The function md5Crypt calculates the MD5-based crypt(3) hash of the
+// password.  The magic string is "$1$" for the standard algorithm, or
+// "$apr1$" for Apache's variant.  Only the first 8 characters of the salt
+// are used.
+func md5Crypt(password, salt, magic string) string {
+	if ndx := strings.IndexByte(salt, '$'); ndx >= 0 {
+		salt = salt[:ndx]
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	final := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for pl := len(pw); pl > 0; pl -= 16 {
+		if pl > 16 {
+			d.Write(final)
+		} else {
+			d.Write(final[:pl])
+		}
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final = d.Sum(nil)
+
+	// Slow things down, to make brute force attacks more expensive
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	f := func(a, b, c int) uint32 {
+		return uint32(final[a])<<16 | uint32(final[b])<<8 | uint32(final[c])
+	}
+	return magic + salt + "$" +
+		to64(f(0, 6, 12), 4) + to64(f(1, 7, 13), 4) + to64(f(2, 8, 14), 4) +
+		to64(f(3, 9, 15), 4) + to64(f(4, 10, 5), 4) + to64(uint32(final[11]), 2)
+}
+
+// The following tables define DES.  The entries are 1-based bit positions,
+// as in FIPS 46-3.
+var (
+	desIP = [64]byte{
+		58, 50, 42, 34, 26, 18, 10, 2, 60, 52, 44, 36, 28, 20, 12, 4,
+		62, 54, 46, 38, 30, 22, 14, 6, 64, 56, 48, 40, 32, 24, 16, 8,
+		57, 49, 41, 33, 25, 17, 9, 1, 59, 51, 43, 35, 27, 19, 11, 3,
+		61, 53, 45, 37, 29, 21, 13, 5, 63, 55, 47, 39, 31, 23, 15, 7,
+	}
+	desFP = [64]byte{
+		40, 8, 48, 16, 56, 24, 64, 32, 39, 7, 47, 15, 55, 23, 63, 31,
+		38, 6, 46, 14, 54, 22, 62, 30, 37, 5, 45, 13, 53, 21, 61, 29,
+		36, 4, 44, 12, 52, 20, 60, 28, 35, 3, 43, 11, 51, 19, 59, 27,
+		34, 2, 42, 10, 50, 18, 58, 26, 33, 1, 41, 9, 49, 17, 57, 25,
+	}
+	desPC1 = [56]byte{
+		57, 49, 41, 33, 25, 17, 9, 1, 58, 50, 42, 34, 26, 18,
+		10, 2, 59, 51, 43, 35, 27, 19, 11, 3, 60, 52, 44, 36,
+		63, 55, 47, 39, 31, 23, 15, 7, 62, 54, 46, 38, 30, 22,
+		14, 6, 61, 53, 45, 37, 29, 21, 13, 5, 28, 20, 12, 4,
+	}
+	desPC2 = [48]byte{
+		14, 17, 11, 24, 1, 5, 3, 28, 15, 6, 21, 10,
+		23, 19, 12, 4, 26, 8, 16, 7, 27, 20, 13, 2,
+		41, 52, 31, 37, 47, 55, 30, 40, 51, 45, 33, 48,
+		44, 49, 39, 56, 34, 53, 46, 42, 50, 36, 29, 32,
+	}
+	desShifts = [16]byte{1, 1, 2, 2, 2, 2, 2, 2, 1, 2, 2, 2, 2, 2, 2, 1}
+	desE      = [48]byte{
+		32, 1, 2, 3, 4, 5, 4, 5, 6, 7, 8, 9,
+		8, 9, 10, 11, 12, 13, 12, 13, 14, 15, 16, 17,
+		16, 17, 18, 19, 20, 21, 20, 21, 22, 23, 24, 25,
+		24, 25, 26, 27, 28, 29, 28, 29, 30, 31, 32, 1,
+	}
+	desP = [32]byte{
+		16, 7, 20, 21, 29, 12, 28, 17, 1, 15, 23, 26, 5, 18, 31, 10,
+		2, 8, 24, 14, 32, 27, 3, 9, 19, 13, 30, 6, 22, 11, 4, 25,
+	}
+	desS = [8][64]byte{
+		{14, 4, 13, 1, 2, 15, 11, 8, 3, 10, 6, 12, 5, 9, 0, 7,
+			0, 15, 7, 4, 14, 2, 13, 1, 10, 6, 12, 11, 9, 5, 3, 8,
+			4, 1, 14, 8, 13, 6, 2, 11, 15, 12, 9, 7, 3, 10, 5, 0,
+			15, 12, 8, 2, 4, 9, 1, 7, 5, 11, 3, 14, 10, 0, 6, 13},
+		{15, 1, 8, 14, 6, 11, 3, 4, 9, 7, 2, 13, 12, 0, 5, 10,
+			3, 13, 4, 7, 15, 2, 8, 14, 12, 0, 1, 10, 6, 9, 11, 5,
+			0, 14, 7, 11, 10, 4, 13, 1, 5, 8, 12, 6, 9, 3, 2, 15,
+			13, 8, 10, 1, 3, 15, 4, 2, 11, 6, 7, 12, 0, 5, 14, 9},
+		{10, 0, 9, 14, 6, 3, 15, 5, 1, 13, 12, 7, 11, 4, 2, 8,
+			13, 7, 0, 9, 3, 4, 6, 10, 2, 8, 5, 14, 12, 11, 15, 1,
+			13, 6, 4, 9, 8, 15, 3, 0, 11, 1, 2, 12, 5, 10, 14, 7,
+			1, 10, 13, 0, 6, 9, 8, 7, 4, 15, 14, 3, 11, 5, 2, 12},
+		{7, 13, 14, 3, 0, 6, 9, 10, 1, 2, 8, 5, 11, 12, 4, 15,
+			13, 8, 11, 5, 6, 15, 0, 3, 4, 7, 2, 12, 1, 10, 14, 9,
+			10, 6, 9, 0, 12, 11, 7, 13, 15, 1, 3, 14, 5, 2, 8, 4,
+			3, 15, 0, 6, 10, 1, 13, 8, 9, 4, 5, 11, 12, 7, 2, 14},
+		{2, 12, 4, 1, 7, 10, 11, 6, 8, 5, 3, 15, 13, 0, 14, 9,
+			14, 11, 2, 12, 4, 7, 13, 1, 5, 0, 15, 10, 3, 9, 8, 6,
+			4, 2, 1, 11, 10, 13, 7, 8, 15, 9, 12, 5, 6, 3, 0, 14,
+			11, 8, 12, 7, 1, 14, 2, 13, 6, 15, 0, 9, 10, 4, 5, 3},
+		{12, 1, 10, 15, 9, 2, 6, 8, 0, 13, 3, 4, 14, 7, 5, 11,
+			10, 15, 4, 2, 7, 12, 9, 5, 6, 1, 13, 14, 0, 11, 3, 8,
+			9, 14, 15, 5, 2, 8, 12, 3, 7, 0, 4, 10, 1, 13, 11, 6,
+			4, 3, 2, 12, 9, 5, 15, 10, 11, 14, 1, 7, 6, 0, 8, 13},
+		{4, 11, 2, 14, 15, 0, 8, 13, 3, 12, 9, 7, 5, 10, 6, 1,
+			13, 0, 11, 7, 4, 9, 1, 10, 14, 3, 5, 12, 2, 15, 8, 6,
+			1, 4, 11, 13, 12, 3, 7, 14, 10, 15, 6, 8, 0, 5, 9, 2,
+			6, 11, 13, 8, 1, 4, 10, 7, 9, 5, 0, 15, 14, 2, 3, 12},
+		{13, 2, 8, 4, 6, 15, 11, 1, 10, 9, 3, 14, 5, 0, 12, 7,
+			1, 15, 13, 8, 10, 3, 7, 4, 12, 5, 6, 11, 0, 14, 9, 2,
+			7, 11, 4, 1, 9, 12, 14, 2, 0, 6, 10, 13, 15, 3, 5, 8,
+			2, 1, 14, 7, 4, 10, 8, 13, 15, 12, 9, 0, 3, 5, 6, 11},
+	}
+)
+
+// The function desCrypt calculates the traditional DES-based crypt(3) hash
+// of the password.  Only the first 8 characters of the password and the
+// first 2 characters of the salt are used.  The computation works on
+// arrays of bits, following the original Unix implementation.
+func desCrypt(password, salt string) string {
+	if len(salt) < 2 {
+		return ""
+	}
+
+	// Each character of the password provides 7 bits of the key
+	var key [64]byte
+	for i := 0; i < len(password) && i < 8; i++ {
+		for j := 0; j < 7; j++ {
+			key[8*i+j] = (password[i] >> uint(6-j)) & 1
+		}
+	}
+
+	// Generate the key schedule
+	var cd [56]byte
+	for i := range cd {
+		cd[i] = key[desPC1[i]-1]
+	}
+	var ks [16][48]byte
+	for round := 0; round < 16; round++ {
+		for n := 0; n < int(desShifts[round]); n++ {
+			c0, d0 := cd[0], cd[28]
+			copy(cd[0:27], cd[1:28])
+			copy(cd[28:55], cd[29:56])
+			cd[27], cd[55] = c0, d0
+		}
+		for i := range ks[round] {
+			ks[round][i] = cd[desPC2[i]-1]
+		}
+	}
+
+	// The salt perturbs the expansion function
+	e := desE
+	for i := 0; i < 2; i++ {
+		c := int(salt[i])
+		if c > 'Z' {
+			c -= 6
+		}
+		if c > '9' {
+			c -= 7
+		}
+		c -= '.'
+		for j := 0; j < 6; j++ {
+			if (c>>uint(j))&1 != 0 {
+				e[6*i+j], e[6*i+j+24] = e[6*i+j+24], e[6*i+j]
+			}
+		}
+	}
+
+	// Encrypt a block of zeros 25 times
+	var block [66]byte
+	for n := 0; n < 25; n++ {
+		var lr [64]byte
+		for i := range lr {
+			lr[i] = block[desIP[i]-1]
+		}
+		l, r := lr[:32], lr[32:]
+		for round := 0; round < 16; round++ {
+			var f [32]byte
+			for s := 0; s < 8; s++ {
+				var b [6]byte
+				for k := 0; k < 6; k++ {
+					b[k] = r[e[6*s+k]-1] ^ ks[round][6*s+k]
+				}
+				v := desS[s][(b[0]<<5)|(b[5]<<4)|(b[1]<<3)|(b[2]<<2)|(b[3]<<1)|b[4]]
+				for k := 0; k < 4; k++ {
+					f[4*s+k] = (v >> uint(3-k)) & 1
+				}
+			}
+			var next [32]byte
+			for i := range next {
+				next[i] = l[i] ^ f[desP[i]-1]
+			}
+			copy(l, r)
+			copy(r, next[:])
+		}
+		var rl [64]byte
+		copy(rl[0:32], r)
+		copy(rl[32:64], l)
+		for i := 0; i < 64; i++ {
+			block[i] = rl[desFP[i]-1]
+		}
+	}
+
+	// Encode the result, using 6 bits for each character
+	ret := []byte(salt[0:2])
+	for i := 0; i < 11; i++ {
+		c := 0
+		for j := 0; j < 6; j++ {
+			c = c<<1 | int(block[6*i+j])
+		}
+		ret = append(ret, itoa64[c])
+	}
+	return string(ret)
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// The following constants name the places where clients send the CSRF
+// token.  Scripts should copy the value of the cookie CsrfCookieName into
+// the header CsrfHeaderName, which is the convention followed by several
+// client-side frameworks.  HTML forms should include the field
+// CsrfFieldName, which is written by CsrfField.
+const (
+	CsrfCookieName = "XSRF-TOKEN"
+	CsrfHeaderName = "X-Xsrf-Token"
+	CsrfFieldName  = "csrf_token"
+)
+
+// The key used to store the CSRF token in the session data.
+const csrfSessionKey = "httpauth.csrf"
+
+// The length, in bytes, of the random CSRF tokens.
+const csrfTokenLen = 32
+
+// CsrfToken returns the CSRF token for the session of the request, creating
+// the token if necessary.  The token is stored in the session data, and so
+// the request must have passed through LoadSession, usually by wrapping the
+// handler using NewHandlerWithAuth.  If the request does not have a
+// session, the return value is blank.
+func (a *Cookie) CsrfToken(r *http.Request) string {
+	data, ok := SessionDataFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+
+	if token, ok := data.Get(csrfSessionKey); ok && token != "" {
+		return token
+	}
+
+	var buffer [csrfTokenLen]byte
+	if _, err := io.ReadFull(rand.Reader, buffer[:]); err != nil {
+		return ""
+	}
+	token := base64.RawURLEncoding.EncodeToString(buffer[:])
+	data.Set(csrfSessionKey, token)
+	return token
+}
+
+// CsrfField returns a hidden input element holding the CSRF token, to be
+// included in HTML forms that use unsafe methods.
+func (a *Cookie) CsrfField(r *http.Request) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CsrfFieldName + `" value="` + template.HTMLEscapeString(a.CsrfToken(r)) + `">`)
+}
+
+// RequireCsrfToken returns a handler that protects the wrapped handler from
+// cross-site request forgery.  For safe methods (GET, HEAD, OPTIONS, and
+// TRACE), the CSRF token for the session is created if necessary, and sent
+// to the client in the cookie CsrfCookieName, which can be read by scripts.
+// For other methods, the request must include the token in the header
+// CsrfHeaderName or the form field CsrfFieldName, or the request is
+// rejected with a 403 response.
+//
+// The session is loaded using LoadSession, unless that has already been
+// done by NewHandlerWithAuth.  Requests without a session are passed to the
+// wrapped handler, which should check authorization.
+func (a *Cookie) RequireCsrfToken(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, save := a.LoadSession(w, r)
+		defer save()
+		if _, ok := SessionDataFromContext(r.Context()); !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		token := a.CsrfToken(r)
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			if cookie, err := r.Cookie(a.csrfCookieName()); err != nil || cookie.Value != token {
+				a.setCsrfCookie(w, token)
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		submitted := r.Header.Get(CsrfHeaderName)
+		if submitted == "" {
+			submitted = r.PostFormValue(CsrfFieldName)
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			a.notifyCsrfFailure(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// The function csrfCookieName returns the name of the cookie that holds the
+// CSRF token, which has the same prefix as the session cookie.
+func (a *Cookie) csrfCookieName() string {
+	if a.CookieOptions.HostPrefix {
+		return "__Host-" + CsrfCookieName
+	}
+	return CsrfCookieName
+}
+
+// The function setCsrfCookie sends the CSRF token to the client.  The
+// cookie has the same attributes as the session cookie, except that it can
+// be read by scripts.
+func (a *Cookie) setCsrfCookie(w http.ResponseWriter, token string) {
+	cookie := a.CookieOptions.NewCookie(a.Path, token)
+	cookie.Name = a.csrfCookieName()
+	cookie.HttpOnly = false
+	http.SetCookie(w, cookie)
+}
+
+func (a *Cookie) notifyCsrfFailure(w http.ResponseWriter, r *http.Request) {
+	if a.isAPIRequest(r) {
+		writeProblem(w, &problem{
+			Status:   http.StatusForbidden,
+			Detail:   "The CSRF token is missing or invalid.",
+			Instance: r.URL.RequestURI(),
+		})
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
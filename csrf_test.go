@@ -0,0 +1,102 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCookieRequireCsrfToken(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+			return username == password
+		})
+		if stateless {
+			policy.SessionSecrets = [][]byte{[]byte("secret")}
+		}
+		handler := NewHandlerWithAuth(policy, policy.RequireCsrfToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s", policy.CsrfField(r))
+		})))
+
+		nonce, err := policy.createSession("user1", "user1")
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		cookies := map[string]string{DefaultCookieName: nonce}
+		do := func(r *http.Request) *httptest.ResponseRecorder {
+			for name, value := range cookies {
+				r.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			for _, cookie := range w.Result().Cookies() {
+				cookies[cookie.Name] = cookie.Value
+			}
+			return w
+		}
+
+		w := do(httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status code, got %d", w.Code)
+		}
+		token := cookies[CsrfCookieName]
+		if token == "" {
+			t.Fatalf("Missing CSRF cookie")
+		}
+		if !strings.Contains(w.Body.String(), `value="`+token+`"`) {
+			t.Errorf("Unexpected form field, got %s", w.Body.String())
+		}
+
+		// The token is stable for the session
+		if w = do(httptest.NewRequest("GET", "/", nil)); !strings.Contains(w.Body.String(), token) {
+			t.Errorf("CSRF token changed")
+		}
+
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set(CsrfHeaderName, token)
+		if w = do(r); w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code for header, got %d", w.Code)
+		}
+
+		r = httptest.NewRequest("POST", "/", strings.NewReader(url.Values{CsrfFieldName: {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if w = do(r); w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code for form, got %d", w.Code)
+		}
+
+		if w = do(httptest.NewRequest("POST", "/", nil)); w.Code != http.StatusForbidden {
+			t.Errorf("Unexpected status code for missing token, got %d", w.Code)
+		}
+
+		r = httptest.NewRequest("DELETE", "/", nil)
+		r.Header.Set(CsrfHeaderName, token+"x")
+		r.Header.Set("Accept", "application/json")
+		if w = do(r); w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("Unexpected response for bad token, got %d", w.Code)
+		}
+	}
+}
+
+func TestCookieRequireCsrfTokenNoSession(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	handler := policy.RequireCsrfToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if policy.CsrfToken(r) != "" {
+			t.Errorf("Unexpected CSRF token")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code, got %d", w.Code)
+	}
+}
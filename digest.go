@@ -5,10 +5,18 @@
 package httpauth
 
 import (
+	"bytes"
 	"container/heap"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"hash"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -24,40 +32,115 @@ const (
 	DefaultClientCacheResidence = 1 * time.Hour
 )
 
+// The constant DefaultMaxBodySize contains the default value used for the
+// MaxBodySize field when creating new Digest instances.
+const (
+	DefaultMaxBodySize = 1 << 20
+)
+
+// The following constants name the quality of protection options supported
+// by the digest authentication scheme.  With QopAuthInt, the hash of the
+// request body is included in the client's response, which protects the
+// body against tampering.
+const (
+	QopAuth    = "auth"
+	QopAuthInt = "auth-int"
+)
+
+// ErrUnknownAlgorithm is returned when a digest is requested using an
+// algorithm that is not supported.
+var ErrUnknownAlgorithm = errors.New("The digest algorithm is not supported.")
+
+// The following constants name the hash algorithms supported by the digest
+// authentication scheme (RFC 7616).  The variants with the suffix '-sess'
+// mix the nonces into the hash of the user's credentials.
+const (
+	AlgorithmMD5            = "MD5"
+	AlgorithmMD5Sess        = "MD5-sess"
+	AlgorithmSHA256         = "SHA-256"
+	AlgorithmSHA256Sess     = "SHA-256-sess"
+	AlgorithmSHA512_256     = "SHA-512-256"
+	AlgorithmSHA512_256Sess = "SHA-512-256-sess"
+)
+
+type digestAlgorithm struct {
+	name    string           // name of the algorithm, as sent in headers
+	newHash func() hash.Hash // constructor for the hash function
+	sess    bool             // true if the session variant of HA1 is used
+}
+
+var digestAlgorithms = []digestAlgorithm{
+	{AlgorithmMD5, md5.New, false},
+	{AlgorithmMD5Sess, md5.New, true},
+	{AlgorithmSHA256, sha256.New, false},
+	{AlgorithmSHA256Sess, sha256.New, true},
+	{AlgorithmSHA512_256, sha512.New512_256, false},
+	{AlgorithmSHA512_256Sess, sha512.New512_256, true},
+}
+
+// The function findDigestAlgorithm returns the algorithm with the given name,
+// or nil if the algorithm is not supported.  Names are not case-sensitive.
+func findDigestAlgorithm(name string) *digestAlgorithm {
+	for i := range digestAlgorithms {
+		if strings.EqualFold(digestAlgorithms[i].name, name) {
+			return &digestAlgorithms[i]
+		}
+	}
+	return nil
+}
+
 type digestClientInfo struct {
 	numContacts uint64 // number of client connects
 	lastContact int64  // time of last communication with this client (unix nanoseconds)
 	nonce       string // unique per client salt
+	created     int64  // time when the nonce was issued (unix nanoseconds)
+	index       [2]int // index of the client in each priority queue
 }
 
-type digestPriorityQueue []*digestClientInfo
+// A digestPriorityQueue orders clients either by the time of last contact,
+// or by the time their nonce was issued.
+type digestPriorityQueue struct {
+	clients []*digestClientInfo
+	order   int
+}
 
-func (pq digestPriorityQueue) Len() int {
-	return len(pq)
+func (pq *digestPriorityQueue) Len() int {
+	return len(pq.clients)
 }
 
-func (pq digestPriorityQueue) Less(i, j int) bool {
-	return pq[i].lastContact < pq[j].lastContact
+func (pq *digestPriorityQueue) Less(i, j int) bool {
+	if pq.order == byCreated {
+		return pq.clients[i].created < pq.clients[j].created
+	}
+	return pq.clients[i].lastContact < pq.clients[j].lastContact
 }
 
-func (pq digestPriorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
+func (pq *digestPriorityQueue) Swap(i, j int) {
+	pq.clients[i], pq.clients[j] = pq.clients[j], pq.clients[i]
+	pq.clients[i].index[pq.order] = i
+	pq.clients[j].index[pq.order] = j
 }
 
 func (pq *digestPriorityQueue) Push(x interface{}) {
-	*pq = append(*pq, x.(*digestClientInfo))
+	ci := x.(*digestClientInfo)
+	ci.index[pq.order] = len(pq.clients)
+	pq.clients = append(pq.clients, ci)
 }
 
 func (pq *digestPriorityQueue) Pop() interface{} {
-	n := len(*pq)
-	ret := (*pq)[n-1]
-	*pq = (*pq)[:n-1]
+	n := len(pq.clients)
+	ret := pq.clients[n-1]
+	pq.clients = pq.clients[:n-1]
 	return ret
 }
 
-func (pq digestPriorityQueue) MinValue() int64 {
-	n := len(pq)
-	return pq[n-1].lastContact
+// The function MinValue returns the client that comes first in the order of
+// the queue, or nil if the queue is empty.
+func (pq *digestPriorityQueue) MinValue() *digestClientInfo {
+	if len(pq.clients) == 0 {
+		return nil
+	}
+	return pq.clients[0]
 }
 
 // A Digest is a policy for authenticating users using the digest authentication scheme.
@@ -70,14 +153,39 @@ type Digest struct {
 	WriteUnauthorized HtmlWriter
 	// This is a nonce used by the HTTP server to prevent dictionary attacks
 	opaque string
+	// Algorithms lists the hash algorithms offered to clients, in order of
+	// preference.  A separate challenge is sent for each algorithm.
+	Algorithms []string
+	// Qop lists the quality of protection options offered to clients.
+	Qop []string
+	// MaxBodySize limits the size of request bodies that will be buffered
+	// to verify their integrity.  Larger requests cannot be authorized
+	// using auth-int.
+	MaxBodySize int64
 
 	// CientCacheResidence controls how long client information is retained
 	ClientCacheResidence time.Duration
+	// NonceLifetime limits how long a nonce can be used after it was issued.
+	// If zero, nonces remain valid until evicted from the client cache.
+	NonceLifetime time.Duration
+	// NonceMaxUses limits the number of requests that can be authorized
+	// using a single nonce.  If zero, the number of requests is not limited.
+	NonceMaxUses uint64
+	// NonceSecrets enables stateless nonces when not empty.  Nonces encode
+	// the time they were issued, and are signed using the first secret.
+	// Nonces signed using any of the secrets are accepted, so that secrets
+	// can be rotated.  Replicas that share the secrets will accept each
+	// other's nonces.  However, without any state, the policy cannot detect
+	// replayed requests, so nonces should be given a short NonceLifetime.
+	NonceSecrets [][]byte
+	// SendNextNonce controls whether a new nonce is sent to clients after
+	// a successful authorization.  See NotifyAuthorized.
+	SendNextNonce bool
 
 	mutex         sync.Mutex
 	clients       map[string]*digestClientInfo
-	lru           digestPriorityQueue
-	md5           hash.Hash
+	lru           digestPriorityQueue // ordered by last contact
+	oldest        digestPriorityQueue // ordered by creation
 	plainPassword bool
 }
 
@@ -87,7 +195,83 @@ func calcHash(h hash.Hash, data string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// The function acceptsAlgorithm returns whether the algorithm is
+// one of those offered to clients.
+func (a *Digest) acceptsAlgorithm(name string) bool {
+	for _, v := range a.Algorithms {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The function opaqueValue returns the opaque value sent to clients.  For
+// stateless nonces, the value is derived from the first secret so that it
+// is shared between replicas.
+func (a *Digest) opaqueValue() string {
+	if len(a.NonceSecrets) == 0 {
+		return a.opaque
+	}
+	return base64.StdEncoding.EncodeToString(signNonce(a.NonceSecrets[0], a.Realm, []byte("opaque")))
+}
+
+// The function acceptsOpaque returns whether the opaque value returned by
+// the client was issued by this policy.
+func (a *Digest) acceptsOpaque(opaque string) bool {
+	if len(a.NonceSecrets) == 0 {
+		return opaque == a.opaque
+	}
+	for _, key := range a.NonceSecrets {
+		if opaque == base64.StdEncoding.EncodeToString(signNonce(key, a.Realm, []byte("opaque"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// The function acceptsQop returns whether the quality of protection is one
+// of those offered to clients.
+func (a *Digest) acceptsQop(qop string) bool {
+	for _, v := range a.Qop {
+		if v == qop {
+			return true
+		}
+	}
+	return false
+}
+
+type digestBody struct {
+	io.Reader
+	io.Closer
+}
+
+// The function hashBody calculates the hash of the body of the HTTP request.
+// The body is buffered, and then restored so that it can still be read by
+// the handler.  If the body is larger than MaxBodySize, an empty string is
+// returned.
+func (a *Digest) hashBody(h hash.Hash, r *http.Request) string {
+	if r.Body == nil {
+		return calcHash(h, "")
+	}
+
+	buffer, err := ioutil.ReadAll(io.LimitReader(r.Body, a.MaxBodySize+1))
+	r.Body = &digestBody{io.MultiReader(bytes.NewReader(buffer), r.Body), r.Body}
+	if err != nil || int64(len(buffer)) > a.MaxBodySize {
+		return ""
+	}
+
+	return calcHash(h, string(buffer))
+}
+
 // NewDigest creates a new authentication policy that uses the digest authentication scheme.
+//
+// If plainPassword is true, the function auth should return the user's
+// password, and the policy will offer the algorithms SHA-256 and MD5.
+// Otherwise, auth should return the hash of the user's credentials (HA1),
+// such as those found in htdigest files.  As the hash depends on the
+// algorithm, the policy will only offer MD5.  Callers that store hashes
+// computed using another algorithm should update the field Algorithms.
 func NewDigest(realm string, auth PasswordLookup, plainPassword bool, writer HtmlWriter) (*Digest, error) {
 	nonce, err := createNonce()
 	if err != nil {
@@ -98,16 +282,28 @@ func NewDigest(realm string, auth PasswordLookup, plainPassword bool, writer Htm
 		writer = defaultHtmlWriter
 	}
 
+	algorithms := []string{AlgorithmMD5}
+	if plainPassword {
+		algorithms = []string{AlgorithmSHA256, AlgorithmMD5}
+	}
+
 	return &Digest{
 		realm,
 		auth,
 		writer,
 		nonce,
+		algorithms,
+		[]string{QopAuth},
+		DefaultMaxBodySize,
 		DefaultClientCacheResidence,
+		0,
+		0,
+		nil,
+		false,
 		sync.Mutex{},
 		make(map[string]*digestClientInfo),
-		nil,
-		md5.New(),
+		digestPriorityQueue{nil, byLastContact},
+		digestPriorityQueue{nil, byCreated},
 		plainPassword}, nil
 }
 
@@ -115,13 +311,26 @@ func (a *Digest) evictLeastRecentlySeen() {
 	now := time.Now().UnixNano()
 
 	// Remove all entries from the client cache older than the
-	// residence time.
-	for len(a.lru) > 0 && a.lru.MinValue()+a.ClientCacheResidence.Nanoseconds() <= now {
-		client := heap.Pop(&a.lru).(*digestClientInfo)
-		delete(a.clients, client.nonce)
+	// residence time, or whose nonce is older than its lifetime.
+	for {
+		if client := a.lru.MinValue(); client != nil && client.lastContact+a.ClientCacheResidence.Nanoseconds() <= now {
+			a.removeClient(client)
+		} else if client := a.oldest.MinValue(); client != nil && a.NonceLifetime != 0 && client.created+a.NonceLifetime.Nanoseconds() <= now {
+			a.removeClient(client)
+		} else {
+			return
+		}
 	}
 }
 
+// The function removeClient deletes the client from the cache and from the
+// priority queues.  The caller must hold the lock.
+func (a *Digest) removeClient(client *digestClientInfo) {
+	delete(a.clients, client.nonce)
+	heap.Remove(&a.lru, client.index[byLastContact])
+	heap.Remove(&a.oldest, client.index[byCreated])
+}
+
 func parseDigestAuthHeader(r *http.Request) map[string]string {
 	// Extract the authentication token.
 	token := r.Header.Get("Authorization")
@@ -133,28 +342,12 @@ func parseDigestAuthHeader(r *http.Request) map[string]string {
 	// protocol.  If not, return nil to indicate failure.  No error
 	// code is used as a malformed protocol is simply an authentication
 	// failure.
-	ndx := strings.IndexRune(token, ' ')
-	if ndx < 1 || token[0:ndx] != "Digest" {
+	credentials, err := ParseCredentials(token)
+	if err != nil || !strings.EqualFold(credentials.Scheme, "Digest") {
 		return nil
 	}
-	token = token[ndx+1:]
 
-	// Token is a comma separated list of name/value pairs.  Break-out pieces
-	// and fill in a map.
-	params := make(map[string]string)
-	for _, str := range strings.Split(token, ",") {
-		ndx := strings.IndexRune(str, '=')
-		if ndx < 1 {
-			// malformed name/value pair
-			// ignore
-			continue
-		}
-		name := strings.Trim(str[0:ndx], `" `)
-		value := strings.Trim(str[ndx+1:], `" `)
-		params[name] = value
-	}
-
-	return params
+	return credentials.Params
 }
 
 // Authorize retrieves the credientials from the HTTP request, and
@@ -168,10 +361,100 @@ func (a *Digest) Authorize(r *http.Request) string {
 		return ""
 	}
 
+	username := a.verifyResponse(r, params)
+	if username == "" {
+		return ""
+	}
+
+	if !a.useNonce(params["nonce"], params["nc"]) {
+		return ""
+	}
+
+	return username
+}
+
+// The function clientAlgorithm returns the hash algorithm selected by the
+// client, or nil if the algorithm is not accepted.  If absent, RFC 2617
+// specifies that MD5 is used.
+func (a *Digest) clientAlgorithm(params map[string]string) *digestAlgorithm {
+	name, ok := params["algorithm"]
+	if !ok {
+		name = AlgorithmMD5
+	}
+	if !a.acceptsAlgorithm(name) {
+		return nil
+	}
+	return findDigestAlgorithm(name)
+}
+
+// The function calcHA1 returns the hash of the user's credentials, or an
+// empty string if the user's password could not be determined.
+func (a *Digest) calcHA1(h hash.Hash, algorithm *digestAlgorithm, params map[string]string) string {
+	username := params["username"]
+	ha1 := a.Auth(username, a.Realm)
+	if ha1 == "" {
+		return ""
+	}
+	if a.plainPassword {
+		ha1 = calcHash(h, username+":"+a.Realm+":"+ha1)
+	}
+	if algorithm.sess {
+		ha1 = calcHash(h, ha1+":"+params["nonce"]+":"+params["cnonce"])
+	}
+	return ha1
+}
+
+// The function calcResponse calculates the digest from the hash of the
+// user's credentials (HA1), and the description of the request (A2).
+func calcResponse(h hash.Hash, ha1, a2 string, params map[string]string) string {
+	ha2 := calcHash(h, a2)
+	return calcHash(h, ha1+":"+params["nonce"]+":"+params["nc"]+
+		":"+params["cnonce"]+":"+params["qop"]+":"+ha2)
+}
+
+// CalcDigestResponse calculates the response that a client would send for
+// the digest authentication scheme.  The parameters must include the
+// username, realm, nonce, uri, qop, nc, and cnonce.  If the algorithm is
+// absent, MD5 is used.  The body is only used when qop is auth-int.
+//
+// This function is intended for testing and debugging.
+func CalcDigestResponse(params map[string]string, password, method string, body []byte) (string, error) {
+	name, ok := params["algorithm"]
+	if !ok {
+		name = AlgorithmMD5
+	}
+	algorithm := findDigestAlgorithm(name)
+	if algorithm == nil {
+		return "", ErrUnknownAlgorithm
+	}
+	h := algorithm.newHash()
+
+	ha1 := calcHash(h, params["username"]+":"+params["realm"]+":"+password)
+	if algorithm.sess {
+		ha1 = calcHash(h, ha1+":"+params["nonce"]+":"+params["cnonce"])
+	}
+	a2 := method + ":" + params["uri"]
+	if params["qop"] == QopAuthInt {
+		a2 += ":" + calcHash(h, string(body))
+	}
+	return calcResponse(h, ha1, a2, params), nil
+}
+
+// The function verifyResponse checks the client's response against the
+// credentials of the user, and returns the username if they match.  The
+// nonce is not checked against the cache of clients.
+func (a *Digest) verifyResponse(r *http.Request, params map[string]string) string {
 	// Verify the token's parameters
-	if params["opaque"] != a.opaque || params["algorithm"] != "MD5" || params["qop"] != "auth" {
+	if !a.acceptsOpaque(params["opaque"]) || !a.acceptsQop(params["qop"]) {
+		return ""
+	}
+
+	// Find the hash algorithm selected by the client.
+	algorithm := a.clientAlgorithm(params)
+	if algorithm == nil {
 		return ""
 	}
+	h := algorithm.newHash()
 
 	// Verify if the requested URI matches auth header
 	switch u, err := url.Parse(params["uri"]); {
@@ -185,31 +468,48 @@ func (a *Digest) Authorize(r *http.Request) string {
 	if username == "" {
 		return ""
 	}
-	ha1 := a.Auth(username, a.Realm)
+	ha1 := a.calcHA1(h, algorithm, params)
 	if ha1 == "" {
 		return ""
 	}
-	if a.plainPassword {
-		ha1 = calcHash(a.md5, username+":"+a.Realm+":"+ha1)
+	a2 := r.Method + ":" + params["uri"]
+	if params["qop"] == QopAuthInt {
+		hbody := a.hashBody(h, r)
+		if hbody == "" {
+			return ""
+		}
+		a2 += ":" + hbody
 	}
-	ha2 := calcHash(a.md5, r.Method+":"+params["uri"])
-	ha3 := calcHash(a.md5, ha1+":"+params["nonce"]+":"+params["nc"]+
-		":"+params["cnonce"]+":"+params["qop"]+":"+ha2)
-	if ha3 != params["response"] {
+	ha3 := calcResponse(h, ha1, a2, params)
+	if subtle.ConstantTimeCompare([]byte(ha3), []byte(params["response"])) != 1 {
 		return ""
 	}
 
+	return username
+}
+
+// The function useNonce checks that the nonce was issued by this server,
+// that it has not expired, and that the nonce count has increased since the
+// last request.  If successful, the client's entry in the cache is updated.
+func (a *Digest) useNonce(nonce, nc string) bool {
 	// Determine the number of contacts that the client believes that
 	// it has had with this serveri.
-	numContacts, err := strconv.ParseUint(params["nc"], 16, 64)
+	numContacts, err := strconv.ParseUint(nc, 16, 64)
 	if err != nil {
-		return ""
+		return false
+	}
+	if a.NonceMaxUses != 0 && numContacts > a.NonceMaxUses {
+		return false
 	}
 
-	// Pull out the nonce, and verify
-	nonce, ok := params["nonce"]
-	if !ok || len(nonce) != nonceLen {
-		return ""
+	// Stateless nonces are checked using their signature
+	if len(a.NonceSecrets) != 0 {
+		return a.useSignedNonce(nonce)
+	}
+
+	// Verify the nonce
+	if len(nonce) != nonceLen {
+		return false
 	}
 
 	// The next block of actions require accessing field internal to the
@@ -222,49 +522,157 @@ func (a *Digest) Authorize(r *http.Request) string {
 	a.evictLeastRecentlySeen()
 
 	// Find the client, and check against authorization parameters.
-	if client, ok := a.clients[nonce]; ok {
-		if client.numContacts != 0 && client.numContacts >= numContacts {
-			return ""
-		}
-		client.numContacts = numContacts
-		client.lastContact = time.Now().UnixNano()
-	} else {
-		return ""
+	client, ok := a.clients[nonce]
+	if !ok {
+		return false
+	}
+	if client.numContacts != 0 && client.numContacts >= numContacts {
+		return false
+	}
+	now := time.Now().UnixNano()
+	if a.NonceLifetime != 0 && client.created+a.NonceLifetime.Nanoseconds() <= now {
+		return false
 	}
+	client.numContacts = numContacts
+	client.lastContact = now
+	heap.Fix(&a.lru, client.index[byLastContact])
 
-	return username
+	return true
+}
+
+// The function useSignedNonce checks that a stateless nonce was signed
+// by this policy, and that it has not expired.  If NonceLifetime is zero,
+// nonces expire after ClientCacheResidence.
+func (a *Digest) useSignedNonce(nonce string) bool {
+	issued, ok := verifySignedNonce(a.NonceSecrets, a.Realm, nonce)
+	if !ok {
+		return false
+	}
+
+	lifetime := a.NonceLifetime
+	if lifetime == 0 {
+		lifetime = a.ClientCacheResidence
+	}
+	now := time.Now()
+	return !issued.After(now) && now.Sub(issued) < lifetime
+}
+
+// The function newNonce creates a nonce for a new challenge.  For stateful
+// nonces, an entry is added to the cache of clients.
+func (a *Digest) newNonce() (string, error) {
+	if len(a.NonceSecrets) != 0 {
+		return createSignedNonce(a.NonceSecrets[0], a.Realm, time.Now())
+	}
+
+	nonce, err := createNonce()
+	if err != nil {
+		return "", err
+	}
+
+	// The next block of actions require accessing field internal to the
+	// digest structure.  Need to lock.
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Check for old clientInfo, so that the cache does not grow when
+	// clients are sent a new nonce with every request.
+	a.evictLeastRecentlySeen()
+
+	// Add the client info to the LRU.
+	now := time.Now().UnixNano()
+	ci := &digestClientInfo{0, now, nonce, now, [2]int{}}
+	a.clients[nonce] = ci
+	heap.Push(&a.lru, ci)
+	heap.Push(&a.oldest, ci)
+
+	return nonce, nil
 }
 
 // NotifyAuthRequired adds the headers to the HTTP response to
 // inform the client of the failed authorization, and which scheme
 // must be used to gain authentication.
+//
+// If the request contains a valid response to an earlier challenge, then
+// authorization must have failed because the nonce was unknown, expired,
+// or reused.  In that case, the challenges are marked as stale so that the
+// client can retry using the new nonce without prompting the user.
 func (a *Digest) NotifyAuthRequired(w http.ResponseWriter, r *http.Request) {
 	// Create an entry for the client
-	nonce, err := createNonce()
+	nonce, err := a.newNonce()
 	if err != nil {
 		http.Error(w, "Internal server error.", http.StatusInternalServerError)
 		return
 	}
 
-	// Create the header
-	hdr := `Digest realm="` + a.Realm + `", nonce="` + nonce + `", opaque="` +
-		a.opaque + `", algorithm="MD5", qop="auth"`
-	w.Header().Set("WWW-Authenticate", hdr)
+	// Check if the client's credentials were correct
+	stale := ""
+	if params := parseDigestAuthHeader(r); params != nil && a.verifyResponse(r, params) != "" {
+		stale = ", stale=TRUE"
+	}
+
+	// Create the headers, one challenge for each algorithm
+	w.Header().Del("WWW-Authenticate")
+	for _, algorithm := range a.Algorithms {
+		if findDigestAlgorithm(algorithm) == nil {
+			continue
+		}
+		hdr := `Digest realm=` + quoteString(a.Realm) + `, nonce="` + nonce + `", opaque="` +
+			a.opaqueValue() + `", algorithm=` + algorithm + `, qop="` + strings.Join(a.Qop, ",") + `"` + stale
+		w.Header().Add("WWW-Authenticate", hdr)
+	}
 	w.WriteHeader(http.StatusUnauthorized)
 	a.WriteUnauthorized(w, r)
+}
 
-	// The next block of actions require accessing field internal to the
-	// digest structure.  Need to lock.
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+// NotifyAuthorized adds the header Authentication-Info to the HTTP response
+// after a successful call to Authorize.  The header contains the server's
+// response (rspauth), which proves to the client that the server also
+// knows the user's credentials.  If SendNextNonce is set, the header also
+// contains a new nonce that the client must use for its next request.  The
+// nonce used for the request is then retired, so that the cache holds a
+// single nonce for each client.  Concurrent requests that still use the
+// retired nonce receive a stale challenge, and can be retried.
+//
+// The response digest covers the body of the HTTP response when the client
+// selected auth-int.  As the body has not been written yet, rspauth is only
+// sent when the client selected auth.
+//
+// This function must be called before the response's headers are written.
+// Handlers wrapped using NewHandlerWithAuth call it automatically.
+func (a *Digest) NotifyAuthorized(w http.ResponseWriter, r *http.Request) {
+	params := parseDigestAuthHeader(r)
+	if params == nil {
+		return
+	}
 
-	// Add the client info to the LRU.
-	ci := &digestClientInfo{0, time.Now().UnixNano(), nonce}
-	a.clients[nonce] = ci
-	heap.Push(&a.lru, ci)
+	hdr := ""
+	if algorithm := a.clientAlgorithm(params); algorithm != nil && params["qop"] == QopAuth && isToken(params["nc"]) {
+		h := algorithm.newHash()
+		if ha1 := a.calcHA1(h, algorithm, params); ha1 != "" {
+			rspauth := calcResponse(h, ha1, ":"+params["uri"], params)
+			hdr = "rspauth=" + quoteString(rspauth) + ", cnonce=" + quoteString(params["cnonce"]) +
+				", nc=" + params["nc"] + ", qop=" + params["qop"]
+		}
+	}
+	if a.SendNextNonce {
+		if nonce, err := a.newNonce(); err == nil {
+			if hdr != "" {
+				hdr += ", "
+			}
+			hdr += "nextnonce=" + quoteString(nonce)
+			// The client must use the next nonce, so the current nonce is
+			// retired to keep the cache from growing with every request
+			a.retireNonce(params["nonce"])
+		}
+	}
+	if hdr != "" {
+		w.Header().Set("Authentication-Info", hdr)
+	}
 }
 
 // Logout removes the nonce associated with the HTTP request from the cache.
+//
+// Stateless nonces cannot be revoked, and remain valid until they expire.
 func (a *Digest) Logout(r *http.Request) {
 	// Extract the authentication parameters
 	params := parseDigestAuthHeader(r)
@@ -272,11 +680,14 @@ func (a *Digest) Logout(r *http.Request) {
 		return
 	}
 
-	nonce, ok := params["nonce"]
-	if !ok {
-		return
+	if nonce, ok := params["nonce"]; ok {
+		a.retireNonce(nonce)
 	}
+}
 
+// The function retireNonce removes the nonce from the cache, so that it can
+// no longer be used.
+func (a *Digest) retireNonce(nonce string) {
 	// The next block of actions require accessing field internal to the
 	// digest structure.  Need to lock.
 	a.mutex.Lock()
@@ -284,7 +695,6 @@ func (a *Digest) Logout(r *http.Request) {
 
 	// Use the nonce to find the entry
 	if client, ok := a.clients[nonce]; ok {
-		// Increase the time since last contact, and force an eviction.
-		client.lastContact = 0
+		a.removeClient(client)
 	}
 }
@@ -9,7 +9,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -107,6 +109,545 @@ func TestDigestBadAuth(t *testing.T) {
 
 }
 
+// The function digestChallenges parses the challenges sent by the server,
+// and returns their parameters keyed by the algorithm.
+func digestChallenges(t *testing.T, resp *http.Response) map[string]map[string]string {
+	ret := make(map[string]map[string]string)
+	for _, hdr := range resp.Header["Www-Authenticate"] {
+		challenges, err := ParseChallenges(hdr)
+		if err != nil {
+			t.Fatalf("Could not parse challenge: %s", hdr)
+		}
+		for _, v := range challenges {
+			ret[v.Params["algorithm"]] = v.Params
+		}
+	}
+	return ret
+}
+
+// The function digestAuthorization creates the Authorization header
+// that a client would send in response to a challenge.
+func digestAuthorization(challenge map[string]string, username, password, method, uri, nc string) string {
+	return digestAuthorizationQop(challenge, username, password, method, uri, nc, QopAuth, "")
+}
+
+// The function digestAuthorizationQop creates the Authorization header
+// that a client would send in response to a challenge, using the specified
+// quality of protection.  The body is only used for auth-int.
+func digestAuthorizationQop(challenge map[string]string, username, password, method, uri, nc, qop, body string) string {
+	const cnonce = "0a4f113b"
+
+	algorithm := findDigestAlgorithm(challenge["algorithm"])
+	h := algorithm.newHash()
+	ha1 := calcHash(h, username+":"+challenge["realm"]+":"+password)
+	if algorithm.sess {
+		ha1 = calcHash(h, ha1+":"+challenge["nonce"]+":"+cnonce)
+	}
+	ha2 := calcHash(h, method+":"+uri)
+	if qop == QopAuthInt {
+		ha2 = calcHash(h, method+":"+uri+":"+calcHash(h, body))
+	}
+	response := calcHash(h, ha1+":"+challenge["nonce"]+":"+nc+":"+cnonce+":"+qop+":"+ha2)
+
+	credentials := Credentials{Scheme: "Digest", Params: map[string]string{
+		"username":  username,
+		"realm":     challenge["realm"],
+		"nonce":     challenge["nonce"],
+		"uri":       uri,
+		"algorithm": algorithm.name,
+		"qop":       qop,
+		"nc":        nc,
+		"cnonce":    cnonce,
+		"response":  response,
+		"opaque":    challenge["opaque"],
+	}}
+	return credentials.String()
+}
+
+func TestDigestAlgorithms(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.Algorithms = []string{AlgorithmSHA512_256, AlgorithmSHA256Sess, AlgorithmSHA256, AlgorithmMD5Sess, AlgorithmMD5}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		username := auth.Authorize(r)
+		if username == "" {
+			auth.NotifyAuthRequired(w, r)
+			return
+		}
+		fmt.Fprintf(w, "Welcome, %s", username)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/digest/")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	resp.Body.Close()
+
+	if hdrs := resp.Header["Www-Authenticate"]; len(hdrs) != len(auth.Algorithms) ||
+		!strings.Contains(hdrs[0], "algorithm="+AlgorithmSHA512_256+",") {
+		t.Fatalf("Incorrect challenges: %v", hdrs)
+	}
+
+	challenges := digestChallenges(t, resp)
+	for _, algorithm := range auth.Algorithms {
+		challenge, ok := challenges[algorithm]
+		if !ok {
+			t.Fatalf("Missing challenge for %s", algorithm)
+		}
+
+		req, err := http.NewRequest("GET", ts.URL+"/digest/", nil)
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		req.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Received incorrect status for %s: %d", algorithm, resp.StatusCode)
+		}
+
+		// Refresh the nonce for the next algorithm
+		resp, err = http.Get(ts.URL + "/digest/")
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		resp.Body.Close()
+		challenges = digestChallenges(t, resp)
+	}
+}
+
+func TestDigestRejectAlgorithm(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.Algorithms = []string{AlgorithmSHA256}
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+	challenge["algorithm"] = AlgorithmMD5
+
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := auth.Authorize(r); username != "" {
+		t.Errorf("Accepted an algorithm that was not offered.")
+	}
+}
+
+func TestDigestAuthInt(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.Qop = []string{QopAuth, QopAuthInt}
+	auth.MaxBodySize = 16
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("POST", "/digest/", nil))
+	if hdr := w.Header().Get("WWW-Authenticate"); !strings.Contains(hdr, `qop="auth,auth-int"`) {
+		t.Fatalf("Incorrect challenge: %s", hdr)
+	}
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	cases := []struct {
+		nc       string
+		signed   string
+		body     string
+		expected string
+	}{
+		{"00000001", "name=user", "name=user", "user"},
+		{"00000002", "name=user", "name=root", ""},
+		{"00000003", "name=user&name=user", "name=user&name=user", ""},
+		{"00000004", "", "", "user"},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("POST", "/digest/", strings.NewReader(v.body))
+		r.Header.Set("Authorization", digestAuthorizationQop(challenge, "user", "user", "POST", "/digest/", v.nc, QopAuthInt, v.signed))
+		if username := auth.Authorize(r); username != v.expected {
+			t.Errorf("Case %d: incorrect username: %s", i, username)
+		}
+
+		// The body must still be available to the handler
+		buffer, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		if string(buffer) != v.body {
+			t.Errorf("Case %d: body was not restored: %s", i, buffer)
+		}
+	}
+}
+
+func TestDigestStale(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.NonceMaxUses = 2
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	if hdr := w.Header().Get("WWW-Authenticate"); strings.Contains(hdr, "stale") {
+		t.Fatalf("Incorrect challenge: %s", hdr)
+	}
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	cases := []struct {
+		password string
+		nc       string
+		expected string
+		stale    bool
+	}{
+		{"user", "00000001", "user", false},
+		{"user", "00000002", "user", false},
+		{"user", "00000003", "", true},
+		{"pass", "00000004", "", false},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("GET", "/digest/", nil)
+		r.Header.Set("Authorization", digestAuthorization(challenge, "user", v.password, "GET", "/digest/", v.nc))
+		if username := auth.Authorize(r); username != v.expected {
+			t.Errorf("Case %d: incorrect username: %s", i, username)
+		}
+		if v.expected != "" {
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		auth.NotifyAuthRequired(w, r)
+		if hdr := w.Header().Get("WWW-Authenticate"); strings.Contains(hdr, "stale=TRUE") != v.stale {
+			t.Errorf("Case %d: incorrect challenge: %s", i, hdr)
+		}
+	}
+}
+
+func TestDigestNonceLifetime(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.NonceLifetime = 10 * time.Millisecond
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := auth.Authorize(r); username != "user" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000002"))
+	if username := auth.Authorize(r); username != "" {
+		t.Errorf("Accepted an expired nonce.")
+	}
+	w = httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, r)
+	if hdr := w.Header().Get("WWW-Authenticate"); !strings.Contains(hdr, "stale=TRUE") {
+		t.Errorf("Incorrect challenge: %s", hdr)
+	}
+}
+
+func TestDigestNonceEviction(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.ClientCacheResidence = 100 * time.Millisecond
+
+	// The first nonce is used, so it is retained longer than the others,
+	// even though it is the oldest
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+	for i := 0; i < 10; i++ {
+		if _, err := auth.newNonce(); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+	}
+	time.Sleep(70 * time.Millisecond)
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := auth.Authorize(r); username != "user" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := auth.newNonce(); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if n := len(auth.clients); n != 2 {
+		t.Errorf("Incorrect number of clients after residence eviction: %d", n)
+	}
+
+	// Nonces past their lifetime are removed, however recently they were
+	// used
+	auth.NonceLifetime = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000002"))
+	if username := auth.Authorize(r); username != "" {
+		t.Errorf("Accepted an expired nonce.")
+	}
+	if n := len(auth.clients); n != 0 || auth.lru.Len() != 0 || auth.oldest.Len() != 0 {
+		t.Errorf("Incorrect number of clients after lifetime eviction: %d", n)
+	}
+}
+
+func TestDigestStatelessNonce(t *testing.T) {
+	lookup := func(username, realm string) string {
+		return username
+	}
+	replica1, err := NewDigest("golang", lookup, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	replica1.NonceSecrets = [][]byte{[]byte("secret2"), []byte("secret1")}
+	replica2, err := NewDigest("golang", lookup, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	replica2.NonceSecrets = [][]byte{[]byte("secret1")}
+
+	// Nonce issued by the second replica using the old secret
+	w := httptest.NewRecorder()
+	replica2.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := replica1.Authorize(r); username != "user" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	// Nonce issued by the first replica using the new secret
+	w = httptest.NewRecorder()
+	replica1.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge = digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := replica2.Authorize(r); username != "" {
+		t.Errorf("Accepted a nonce signed with an unknown secret.")
+	}
+
+	// Tampered nonce
+	nonce := []byte(challenge["nonce"])
+	nonce[0] ^= 1
+	challenge["nonce"] = string(nonce)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := replica1.Authorize(r); username != "" {
+		t.Errorf("Accepted a tampered nonce.")
+	}
+}
+
+func TestDigestStatelessNonceLifetime(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.NonceSecrets = [][]byte{[]byte("secret")}
+	auth.NonceLifetime = 10 * time.Millisecond
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	time.Sleep(20 * time.Millisecond)
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	if username := auth.Authorize(r); username != "" {
+		t.Errorf("Accepted an expired nonce.")
+	}
+	w = httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, r)
+	if hdr := w.Header().Get("WWW-Authenticate"); !strings.Contains(hdr, "stale=TRUE") {
+		t.Errorf("Incorrect challenge: %s", hdr)
+	}
+}
+
+func TestWrapDigestAuthenticationInfo(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.SendNextNonce = true
+	handler := NewHandlerWithAuth(auth, http.HandlerFunc(wrappedHandler))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Received incorrect status: %d", w.Code)
+	}
+
+	hdr := w.Header().Get("Authentication-Info")
+	info, err := ParseAuthParams(hdr)
+	if err != nil {
+		t.Fatalf("Could not parse header: %s", hdr)
+	}
+
+	h := findDigestAlgorithm(AlgorithmSHA256).newHash()
+	ha1 := calcHash(h, "user:golang:user")
+	ha2 := calcHash(h, ":/digest/")
+	rspauth := calcHash(h, ha1+":"+challenge["nonce"]+":00000001:"+info["cnonce"]+":auth:"+ha2)
+	if info["rspauth"] != rspauth || info["nc"] != "00000001" || info["cnonce"] == "" {
+		t.Errorf("Incorrect header: %s", hdr)
+	}
+
+	// The next nonce can be used for the following request
+	if info["nextnonce"] == "" {
+		t.Fatalf("Missing next nonce: %s", hdr)
+	}
+	challenge["nonce"] = info["nextnonce"]
+	r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Received incorrect status: %d", w.Code)
+	}
+}
+
+func TestDigestNextNonceCache(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.Algorithms = []string{AlgorithmSHA256}
+	auth.SendNextNonce = true
+	handler := NewHandlerWithAuth(auth, http.HandlerFunc(wrappedHandler))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	// Each request uses the next nonce from the previous response, and the
+	// cache must not grow with the number of requests
+	for i := 0; i < 100; i++ {
+		r := httptest.NewRequest("GET", "/digest/", nil)
+		r.Header.Set("Authorization", digestAuthorization(challenge, "user", "user", "GET", "/digest/", "00000001"))
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Received incorrect status: %d", w.Code)
+		}
+		info, err := ParseAuthParams(w.Header().Get("Authentication-Info"))
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		challenge["nonce"] = info["nextnonce"]
+	}
+	if n := len(auth.clients); n != 1 {
+		t.Errorf("Incorrect number of clients: %d", n)
+	}
+}
+
+func TestDigestAuthenticationInfoQuoting(t *testing.T) {
+	auth, err := NewDigest("golang", func(username, realm string) string {
+		return username
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	auth.Algorithms = []string{AlgorithmSHA256}
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+
+	params := map[string]string{
+		"username":  "user",
+		"realm":     challenge["realm"],
+		"nonce":     challenge["nonce"],
+		"uri":       "/digest/",
+		"algorithm": AlgorithmSHA256,
+		"qop":       QopAuth,
+		"nc":        "00000001",
+		"cnonce":    `a"b\c`,
+		"opaque":    challenge["opaque"],
+	}
+	response, err := CalcDigestResponse(params, "user", "GET", nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	params["response"] = response
+
+	r := httptest.NewRequest("GET", "/digest/", nil)
+	r.Header.Set("Authorization", (&Credentials{Scheme: "Digest", Params: params}).String())
+	if username := auth.Authorize(r); username != "user" {
+		t.Fatalf("Incorrect username: %s", username)
+	}
+	w = httptest.NewRecorder()
+	auth.NotifyAuthorized(w, r)
+
+	hdr := w.Header().Get("Authentication-Info")
+	info, err := ParseAuthParams(hdr)
+	if err != nil {
+		t.Fatalf("Could not parse header: %s", hdr)
+	}
+	if info["cnonce"] != params["cnonce"] || info["nc"] != "00000001" {
+		t.Errorf("Incorrect header: %s", hdr)
+	}
+}
+
+func TestDigestQuotedUsername(t *testing.T) {
+	auth, err := NewDigest(`go "lang"`, func(username, realm string) string {
+		return "secret"
+	}, true, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	auth.NotifyAuthRequired(w, httptest.NewRequest("GET", "/digest/", nil))
+	challenge := digestChallenges(t, w.Result())[AlgorithmSHA256]
+	if challenge["realm"] != `go "lang"` {
+		t.Fatalf("Incorrect realm: %s", challenge["realm"])
+	}
+
+	r := httptest.NewRequest("GET", "/digest/?a=b,c", nil)
+	r.Header.Set("Authorization", digestAuthorization(challenge, `doe, "john"`, "secret", "GET", "/digest/?a=b,c", "00000001"))
+	if username := auth.Authorize(r); username != `doe, "john"` {
+		t.Errorf("Incorrect username: %s", username)
+	}
+}
+
 func TestDigestBrowser(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test of digest authorization.")
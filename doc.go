@@ -12,7 +12,10 @@
 // To support the basic authentication scheme, callers will need to provide a
 // function or closure that can validate a user's credentials (i.e. a username
 // and password pair).  Alternatively, callers can provide a function that will
-// retrieve the password for a given username.
+// retrieve the password for a given username.  Credentials stored in Apache's
+// htpasswd files can be validated using OpenHtpasswd, and edited using
+// HtpasswdFile.  The command httpauth, in the directory cmd/httpauth, can be
+// used to manage these files from the shell.
 //
 // To support the digest authentication scheme, callers will need to provide a
 // function or cluse that can retrieve the password for a given username.  The
@@ -23,5 +26,6 @@
 // to obtain the user's credentials.  After these credentials have been
 // verified, a cookie is set on the clients computer containing a token.
 // The presence (and validity) of this token serves to authorize future
-// HTTP requests.
+// HTTP requests.  Handlers that accept forms or other unsafe requests should
+// be protected from cross-site request forgery using RequireCsrfToken.
 package httpauth
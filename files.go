@@ -1,80 +1,278 @@
 package httpauth
 
 import (
+	"bufio"
 	"encoding/csv"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+/*
+FileOptions control how credential files are reloaded after they have
+been opened. A nil *FileOptions is equivalent to the zero value.
+*/
+type FileOptions struct {
+	// OnError is called when a modified file cannot be reloaded. The
+	// users loaded previously remain in effect until the file is fixed.
+	// The error is reported once for each modification of the file.
+	OnError func(error)
+	// PollInterval sets the minimum time between checks for modifications
+	// of the file. If zero, the file is checked on every lookup.
+	PollInterval time.Duration
+}
+
+/*
+A FileError describes a syntax error in a credential file.
+*/
+type FileError struct {
+	Path string // path of the file
+	Line int    // line number where the error occurred
+	Msg  string // description of the error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+/*
+Structure used to reload credential files when they change. The file
+is safe for concurrent use. Reloads are serialized, and lookups never
+wait for a reload in progress; they continue to use the previous table,
+which the inherited types replace atomically once the new table is
+complete.
+*/
 type file struct {
-	Path string
-	Info os.FileInfo
+	Path    string
+	Options FileOptions
 	/* must be set in inherited types during initialization */
-	Reload func()
+	Reload func() error
+
+	mutex sync.Mutex /* held while checking or reloading the file */
+	info  os.FileInfo
+	/* set when the last call to os.Stat failed, to report errors once */
+	statFailed bool
+	/* time of the last check for modifications (unix nanoseconds) */
+	lastCheck int64
+}
+
+/*
+Load reads the file for the first time. Errors are returned to the
+caller instead of being reported.
+*/
+func (f *file) Load() error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	if err := f.Reload(); err != nil {
+		return err
+	}
+	f.info = info
+	atomic.StoreInt64(&f.lastCheck, time.Now().UnixNano())
+	return nil
 }
 
 func (f *file) ReloadIfNeeded() {
+	// Limit the checks to one per polling interval
+	if f.Options.PollInterval > 0 {
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&f.lastCheck)
+		if now-last < f.Options.PollInterval.Nanoseconds() {
+			return
+		}
+		if !atomic.CompareAndSwapInt64(&f.lastCheck, last, now) {
+			// Another goroutine is checking the file
+			return
+		}
+	}
+
+	// If another goroutine is reloading the file, don't wait
+	if !f.mutex.TryLock() {
+		return
+	}
+	defer f.mutex.Unlock()
+
 	info, err := os.Stat(f.Path)
 	if err != nil {
-		panic(err)
+		if !f.statFailed {
+			f.statFailed = true
+			f.reportError(err)
+		}
+		return
+	}
+	f.statFailed = false
+
+	if f.info == nil || f.info.ModTime() != info.ModTime() || f.info.Size() != info.Size() {
+		// Record the new file information even if the reload fails, so
+		// that the file is not parsed again until it is modified.
+		f.info = info
+		if err := f.Reload(); err != nil {
+			f.reportError(err)
+		}
 	}
-	if f.Info == nil || f.Info.ModTime() != info.ModTime() {
-		f.Info = info
-		f.Reload()
+}
+
+func (f *file) reportError(err error) {
+	if f.Options.OnError != nil {
+		f.Options.OnError(err)
 	}
 }
 
 /*
- Structure used for htdigest file authentication. Users map realms to
- maps of users to their HA1 digests.
+Structure used for htdigest file authentication. Users map realms to
+maps of users to their HA1 digests.
 */
 type htdigestFile struct {
 	file
-	Users map[string]map[string]string
+	users atomic.Value /* map[string]map[string]string */
+}
+
+func (hf *htdigestFile) Users() map[string]map[string]string {
+	users, _ := hf.users.Load().(map[string]map[string]string)
+	return users
 }
 
-func reload_htdigest(hf *htdigestFile) {
+func reload_htdigest(hf *htdigestFile) error {
 	r, err := os.Open(hf.Path)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer r.Close()
+
 	csv_reader := csv.NewReader(r)
 	csv_reader.Comma = ':'
 	csv_reader.Comment = '#'
 	csv_reader.TrimLeadingSpace = true
+	csv_reader.FieldsPerRecord = 3
 
 	records, err := csv_reader.ReadAll()
 	if err != nil {
-		panic(err)
+		if perr, ok := err.(*csv.ParseError); ok {
+			return &FileError{hf.Path, perr.Line, perr.Err.Error()}
+		}
+		return err
 	}
 
-	hf.Users = make(map[string]map[string]string)
+	// Build the new table before replacing the old one, so that the
+	// previous users remain in effect if there is an error.
+	users := make(map[string]map[string]string)
 	for _, record := range records {
-		_, exists := hf.Users[record[1]]
+		_, exists := users[record[1]]
 		if !exists {
-			hf.Users[record[1]] = make(map[string]string)
+			users[record[1]] = make(map[string]string)
 		}
-		hf.Users[record[1]][record[0]] = record[2]
+		users[record[1]][record[0]] = record[2]
 	}
+	hf.users.Store(users)
+	return nil
 }
 
 /*
- SecretProvider implementation based on htdigest-formated files. Will
- reload htdigest file on changes. Will panic on syntax errors in
- htdigest files.
+SecretProvider implementation based on htdigest-formated files. Will
+reload htdigest file on changes. The returned function is safe for
+concurrent use.
+
+An error is returned if the file cannot be read or parsed when it is
+opened. If the file later becomes unreadable or malformed, the users
+loaded previously remain in effect, and the error is reported to
+options.OnError.
 */
-func OpenHtdigest(filename string) PasswordLookup {
+func OpenHtdigest(filename string, options *FileOptions) (PasswordLookup, error) {
 	hf := &htdigestFile{file: file{Path: filename}}
-	hf.Reload = func() { reload_htdigest(hf) }
+	if options != nil {
+		hf.Options = *options
+	}
+	hf.Reload = func() error { return reload_htdigest(hf) }
+	if err := hf.Load(); err != nil {
+		return nil, err
+	}
+
 	return func(user, realm string) string {
 		hf.ReloadIfNeeded()
-		_, exists := hf.Users[realm]
+		users := hf.Users()
+		_, exists := users[realm]
 		if !exists {
 			return ""
 		}
-		digest, exists := hf.Users[realm][user]
+		digest, exists := users[realm][user]
 		if !exists {
 			return ""
 		}
 		return digest
+	}, nil
+}
+
+/*
+Structure used for htpasswd file authentication. Users map usernames
+to their password hashes.
+*/
+type htpasswdFile struct {
+	file
+	users atomic.Value /* map[string]string */
+}
+
+func (hf *htpasswdFile) Users() map[string]string {
+	users, _ := hf.users.Load().(map[string]string)
+	return users
+}
+
+func reload_htpasswd(hf *htpasswdFile) error {
+	r, err := os.Open(hf.Path)
+	if err != nil {
+		return err
 	}
+	defer r.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		// The hash ends at the next colon, if any, as with Apache
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return &FileError{hf.Path, lineno, "expected username:password"}
+		}
+		users[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	hf.users.Store(users)
+	return nil
+}
+
+/*
+Authenticator implementation based on htpasswd-formated files. Will
+reload htpasswd file on changes. Errors are handled as for OpenHtdigest.
+
+Passwords can be hashed using bcrypt ($2y$), Apache's MD5 ($apr1$),
+SHA-1 ({SHA}), or crypt(3), or can be stored as plain text. As htpasswd
+files do not contain realms, the realm is ignored.
+*/
+func OpenHtpasswd(filename string, options *FileOptions) (Authenticator, error) {
+	hf := &htpasswdFile{file: file{Path: filename}}
+	if options != nil {
+		hf.Options = *options
+	}
+	hf.Reload = func() error { return reload_htpasswd(hf) }
+	if err := hf.Load(); err != nil {
+		return nil, err
+	}
+
+	return func(user, password, realm string) bool {
+		hf.ReloadIfNeeded()
+		hash, exists := hf.Users()[user]
+		if !exists {
+			return false
+		}
+		return verifyPasswordHash(hash, password)
+	}, nil
 }
@@ -0,0 +1,261 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyPasswordHash(t *testing.T) {
+	cases := []struct {
+		hash     string
+		password string
+	}{
+		{"$2a$05$ktAUvmo7yBsXfTDjbdZZOeyq4mPnxEfJRwary4c2ybbTRzTOJBPE.", "password"},
+		{"$2y$05$ktAUvmo7yBsXfTDjbdZZOeyq4mPnxEfJRwary4c2ybbTRzTOJBPE.", "password"},
+		{"$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", "password"},
+		{"$apr1$abc$unjsHnWJQp7BGGss6.YCN0", "a longer password for apr1"},
+		{"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", "password"},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password"},
+		{"abJnggxhB/yWI", "password"},
+		{"xy/gRonXQz8UE", "secret"},
+		{"plain text", "plain text"},
+	}
+
+	for i, v := range cases {
+		if !verifyPasswordHash(v.hash, v.password) {
+			t.Errorf("Case %d: false negative for %s", i, v.hash)
+		}
+		if verifyPasswordHash(v.hash, "x"+v.password) {
+			t.Errorf("Case %d: false positive for %s", i, v.hash)
+		}
+	}
+}
+
+func TestVerifyPasswordHashUnknown(t *testing.T) {
+	// Hashes in unsupported formats must not be accepted as plain text
+	cases := []string{
+		"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/",
+		"$5$saltsalt$eAUyxNyLG6pEJXvDcVAjlq1nOK3i6xM/c6iWPQKBv./",
+		"$2x$05$ktAUvmo7yBsXfTDjbdZZOeyq4mPnxEfJRwary4c2ybbTRzTOJBPE.",
+		"{SSHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"",
+	}
+
+	for i, v := range cases {
+		if verifyPasswordHash(v, v) {
+			t.Errorf("Case %d: accepted the hash as a password", i)
+		}
+	}
+}
+
+func TestHashPasswordPlain(t *testing.T) {
+	cases := []struct {
+		password string
+		err      error
+	}{
+		{"secret", nil},
+		{"plain text", nil},
+		{"", ErrAmbiguousPassword},
+		{"$6$salt$hash", ErrAmbiguousPassword},
+		{"{SHA}password", ErrAmbiguousPassword},
+		{"abcdefghijklm", ErrAmbiguousPassword},
+	}
+
+	for i, v := range cases {
+		hash, err := HashPassword(v.password, HashPlain)
+		if err != v.err {
+			t.Errorf("Case %d: incorrect error: %v", i, err)
+		}
+		if err == nil && !verifyPasswordHash(hash, v.password) {
+			t.Errorf("Case %d: false negative", i)
+		}
+	}
+}
+
+func TestOpenHtpasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "htpasswd")
+	data := "# comment\n" +
+		"bcrypt:$2y$05$ktAUvmo7yBsXfTDjbdZZOeyq4mPnxEfJRwary4c2ybbTRzTOJBPE.\n" +
+		"\n" +
+		"apr1:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n" +
+		"sha:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n" +
+		"crypt:abJnggxhB/yWI\n" +
+		"plain:password:comment\n"
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	auth, err := OpenHtpasswd(filename, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	for _, username := range []string{"bcrypt", "apr1", "sha", "crypt", "plain"} {
+		if !auth(username, "password", "golang") {
+			t.Errorf("False negative for %s", username)
+		}
+		if auth(username, "wrong", "golang") {
+			t.Errorf("False positive for %s", username)
+		}
+	}
+	if auth("unknown", "password", "golang") {
+		t.Errorf("False positive for unknown user")
+	}
+}
+
+// The function rewriteFile replaces the contents of the file, and ensures
+// that the modification time changes.  The file is replaced atomically,
+// so that readers never observe a partially written file.
+func rewriteFile(t *testing.T, filename, data string, age time.Duration) {
+	tmpname := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpname, []byte(data), 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(tmpname, mtime, mtime); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := os.Rename(tmpname, filename); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+}
+
+func TestOpenHtdigestErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "htdigest")
+
+	// Missing file
+	if _, err := OpenHtdigest(filename, nil); err == nil {
+		t.Errorf("Opened a missing file.")
+	}
+
+	// Malformed file
+	rewriteFile(t, filename, "user:golang\n", time.Hour)
+	if _, err := OpenHtdigest(filename, nil); err == nil {
+		t.Errorf("Opened a malformed file.")
+	} else if ferr, ok := err.(*FileError); !ok || ferr.Line != 1 {
+		t.Errorf("Incorrect error: %s", err)
+	}
+
+	// Valid file
+	rewriteFile(t, filename, "user:golang:0123\n", time.Hour)
+	var errs []error
+	lookup, err := OpenHtdigest(filename, &FileOptions{OnError: func(err error) {
+		errs = append(errs, err)
+	}})
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if ha1 := lookup("user", "golang"); ha1 != "0123" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+
+	// The last good table is used while the file is malformed
+	rewriteFile(t, filename, "user:golang\nroot:golang:4567\n", time.Minute)
+	if ha1 := lookup("user", "golang"); ha1 != "0123" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	if ha1 := lookup("root", "golang"); ha1 != "" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	if len(errs) != 1 {
+		t.Errorf("Incorrect number of errors reported: %v", errs)
+	}
+
+	// The last good table is used while the file is missing
+	os.Remove(filename)
+	lookup("user", "golang")
+	if ha1 := lookup("user", "golang"); ha1 != "0123" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Incorrect number of errors reported: %v", errs)
+	}
+
+	// The file is fixed
+	rewriteFile(t, filename, "root:golang:4567\n", 0)
+	if ha1 := lookup("root", "golang"); ha1 != "4567" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	if ha1 := lookup("user", "golang"); ha1 != "" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+}
+
+func TestOpenHtdigestPollInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "htdigest")
+
+	rewriteFile(t, filename, "user:golang:0123\n", time.Hour)
+	lookup, err := OpenHtdigest(filename, &FileOptions{PollInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	// The modification is not noticed until the interval has passed
+	rewriteFile(t, filename, "user:golang:4567\n", time.Minute)
+	if ha1 := lookup("user", "golang"); ha1 != "0123" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ha1 := lookup("user", "golang"); ha1 != "4567" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+}
+
+func TestOpenHtdigestConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "htdigest")
+
+	rewriteFile(t, filename, "user:golang:0123\n", time.Hour)
+	lookup, err := OpenHtdigest(filename, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 200; j++ {
+				if ha1 := lookup("user", "golang"); ha1 != "0123" && ha1 != "4567" {
+					t.Errorf("Incorrect HA1: %s", ha1)
+				}
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			rewriteFile(t, filename, "user:golang:4567\n", time.Duration(i)*time.Second)
+		} else {
+			rewriteFile(t, filename, "user:golang:0123\n", time.Duration(i)*time.Second)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The following variables are used to specify error conditions when
+// editing credential files.
+var (
+	ErrUserExists   = errors.New("The user already exists.")
+	ErrUserNotFound = errors.New("The user does not exist.")
+	ErrInvalidName  = errors.New("The username or realm contains invalid characters.")
+)
+
+// An HtdigestFile edits the users stored in an htdigest file, as used by
+// OpenHtdigest.  Each line of the file holds a username, a realm, and the
+// MD5 hash of the user's credentials (HA1).
+//
+// Changes are written to a temporary file, which then replaces the
+// original file atomically.  While editing, the file is locked to prevent
+// concurrent edits from other processes.  Comments and blank lines are
+// preserved.
+type HtdigestFile struct {
+	// Path is the location of the file.  The file is created when the
+	// first user is added.
+	Path string
+}
+
+// An HtpasswdFile edits the users stored in an htpasswd file, as used by
+// OpenHtpasswd.  Each line of the file holds a username and the hash of the
+// user's password.  Changes are made as for HtdigestFile.
+type HtpasswdFile struct {
+	// Path is the location of the file.  The file is created when the
+	// first user is added.
+	Path string
+	// Format selects how new passwords are hashed.  If empty, bcrypt is used.
+	Format string
+}
+
+// CalcHA1 returns the MD5 hash of the user's credentials, as stored in
+// htdigest files, and as expected by NewDigest when plainPassword is false.
+func CalcHA1(username, realm, password string) string {
+	return calcHash(md5.New(), username+":"+realm+":"+password)
+}
+
+// The function validName returns whether or not the name can be stored in a
+// credential file.  Leading spaces are removed by the readers, and so are
+// not allowed.
+func validName(name string) bool {
+	return name != "" && name[0] != '#' && name[0] != ' ' && name[0] != '\t' &&
+		!strings.ContainsAny(name, ":\r\n")
+}
+
+// The function validDigestName returns whether or not the name can be
+// stored in an htdigest file, which is read as CSV, and so cannot contain
+// quotes.
+func validDigestName(name string) bool {
+	return validName(name) && !strings.ContainsRune(name, '"')
+}
+
+// Add adds a new user to the file.  If the user already exists in that
+// realm, ErrUserExists is returned.
+func (f *HtdigestFile) Add(username, realm, password string) error {
+	return f.set(username, realm, password, false)
+}
+
+// Update changes the password of a user.  If the user does not exist in
+// that realm, ErrUserNotFound is returned.
+func (f *HtdigestFile) Update(username, realm, password string) error {
+	return f.set(username, realm, password, true)
+}
+
+func (f *HtdigestFile) set(username, realm, password string, update bool) error {
+	if !validDigestName(username) || !validDigestName(realm) {
+		return ErrInvalidName
+	}
+
+	entry := username + ":" + realm + ":" + CalcHA1(username, realm, password)
+	return editFile(f.Path, true, func(lines []string) ([]string, error) {
+		ndx := findLine(lines, username+":"+realm+":")
+		switch {
+		case ndx >= 0 && !update:
+			return nil, ErrUserExists
+		case ndx < 0 && update:
+			return nil, ErrUserNotFound
+		case ndx >= 0:
+			lines[ndx] = entry
+			return lines, nil
+		}
+		return append(lines, entry), nil
+	})
+}
+
+// Delete removes a user from the file.  If the user does not exist in
+// that realm, ErrUserNotFound is returned.
+func (f *HtdigestFile) Delete(username, realm string) error {
+	if !validDigestName(username) || !validDigestName(realm) {
+		return ErrInvalidName
+	}
+
+	return editFile(f.Path, false, func(lines []string) ([]string, error) {
+		ndx := findLine(lines, username+":"+realm+":")
+		if ndx < 0 {
+			return nil, ErrUserNotFound
+		}
+		return append(lines[:ndx], lines[ndx+1:]...), nil
+	})
+}
+
+// List returns the sorted names of the users in the realm.
+func (f *HtdigestFile) List(realm string) ([]string, error) {
+	lines, err := readLines(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, line := range lines {
+		fields := strings.Split(line, ":")
+		if len(fields) == 3 && fields[1] == realm && !strings.HasPrefix(line, "#") {
+			ret = append(ret, fields[0])
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Add adds a new user to the file.  If the user already exists,
+// ErrUserExists is returned.
+func (f *HtpasswdFile) Add(username, password string) error {
+	return f.set(username, password, false)
+}
+
+// Update changes the password of a user.  If the user does not exist,
+// ErrUserNotFound is returned.
+func (f *HtpasswdFile) Update(username, password string) error {
+	return f.set(username, password, true)
+}
+
+func (f *HtpasswdFile) set(username, password string, update bool) error {
+	if !validName(username) {
+		return ErrInvalidName
+	}
+
+	format := f.Format
+	if format == "" {
+		format = HashBcrypt
+	}
+	hash, err := HashPassword(password, format)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(hash, ":\r\n") {
+		// Only possible for plain text passwords
+		return ErrInvalidName
+	}
+
+	entry := username + ":" + hash
+	return editFile(f.Path, true, func(lines []string) ([]string, error) {
+		ndx := findLine(lines, username+":")
+		switch {
+		case ndx >= 0 && !update:
+			return nil, ErrUserExists
+		case ndx < 0 && update:
+			return nil, ErrUserNotFound
+		case ndx >= 0:
+			lines[ndx] = entry
+			return lines, nil
+		}
+		return append(lines, entry), nil
+	})
+}
+
+// Delete removes a user from the file.  If the user does not exist,
+// ErrUserNotFound is returned.
+func (f *HtpasswdFile) Delete(username string) error {
+	if !validName(username) {
+		return ErrInvalidName
+	}
+
+	return editFile(f.Path, false, func(lines []string) ([]string, error) {
+		ndx := findLine(lines, username+":")
+		if ndx < 0 {
+			return nil, ErrUserNotFound
+		}
+		return append(lines[:ndx], lines[ndx+1:]...), nil
+	})
+}
+
+// List returns the sorted names of the users.
+func (f *HtpasswdFile) List() ([]string, error) {
+	lines, err := readLines(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, line := range lines {
+		if ndx := strings.IndexByte(line, ':'); ndx > 0 && line[0] != '#' {
+			ret = append(ret, line[:ndx])
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// The function findLine returns the index of the line that starts with the
+// prefix, or -1 if there is no such line.  Comments are skipped.
+func findLine(lines []string, prefix string) int {
+	for i, line := range lines {
+		if strings.HasPrefix(line, prefix) && !strings.HasPrefix(line, "#") {
+			return i
+		}
+	}
+	return -1
+}
+
+// The function readLines returns the lines of the file.  A missing file
+// is treated as empty.
+func readLines(path string) ([]string, error) {
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// The function editFile locks the file, applies the edit to its lines,
+// and then replaces the file atomically.  If the edit returns an error,
+// the file is not changed.  If create is false, a missing file is treated
+// as empty, but is not created.
+func editFile(path string, create bool, edit func(lines []string) ([]string, error)) error {
+	lock, err := openLocked(path, create)
+	if os.IsNotExist(err) && !create {
+		_, err = edit(nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		unlockFile(lock)
+		lock.Close()
+	}()
+
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	lines, err = edit(lines)
+	if err != nil {
+		return err
+	}
+
+	info, err := lock.Stat()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(strings.Join(append(lines, ""), "\n")), info.Mode().Perm())
+}
+
+// The function openLocked opens and locks the file, creating it if
+// necessary and create is true.  As files are replaced by renaming, the file that was locked
+// may no longer be at the path once the lock is acquired.  In that case,
+// the lock is retried with the new file.
+func openLocked(path string, create bool) (*os.File, error) {
+	flag := os.O_RDONLY
+	if create {
+		flag |= os.O_CREATE
+	}
+
+	for {
+		f, err := os.OpenFile(path, flag, 0640)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return f, nil
+		}
+		unlockFile(f)
+		f.Close()
+	}
+}
+
+// The function writeFileAtomic writes the data to a temporary file in the
+// same directory, and then renames the temporary file to replace the file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,253 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestHtdigestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := HtdigestFile{filepath.Join(dir, "htdigest")}
+	if err := ioutil.WriteFile(f.Path, []byte("# users\n"), 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	if err := f.Add("user1", "golang", "pass1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Add("user2", "golang", "pass2"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Add("user1", "c++", "pass1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Add("user1", "golang", "pass1"); err != ErrUserExists {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := f.Add("us:er", "golang", "pass1"); err != ErrInvalidName {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := f.Update("user2", "golang", "pass3"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Update("user3", "golang", "pass3"); err != ErrUserNotFound {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := f.Delete("user1", "c++"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Delete("user1", "c++"); err != ErrUserNotFound {
+		t.Errorf("Incorrect error: %v", err)
+	}
+
+	users, err := f.List("golang")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if !reflect.DeepEqual(users, []string{"user1", "user2"}) {
+		t.Errorf("Incorrect users: %v", users)
+	}
+
+	// The file must be readable by the lookup
+	lookup, err := OpenHtdigest(f.Path, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if ha1 := lookup("user2", "golang"); ha1 != CalcHA1("user2", "golang", "pass3") {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+	if ha1 := lookup("user1", "c++"); ha1 != "" {
+		t.Errorf("Incorrect HA1: %s", ha1)
+	}
+
+	// Comments are preserved
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if string(data[:8]) != "# users\n" {
+		t.Errorf("Comment was not preserved: %s", data)
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "htpasswd")
+	for _, format := range []string{HashBcrypt, HashAPR1, HashSHA1, HashCrypt, HashPlain} {
+		f := HtpasswdFile{path, format}
+		if err := f.Add(format, "password"); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+	}
+	f := HtpasswdFile{Path: path}
+	if err := f.Update(HashPlain, "secret"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := f.Delete(HashSHA1); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := (&HtpasswdFile{path, "md4"}).Add("user", "password"); err != ErrUnknownHashFormat {
+		t.Errorf("Incorrect error: %v", err)
+	}
+
+	users, err := f.List()
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if !reflect.DeepEqual(users, []string{HashAPR1, HashBcrypt, HashCrypt, HashPlain}) {
+		t.Errorf("Incorrect users: %v", users)
+	}
+
+	auth, err := OpenHtpasswd(path, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	for _, username := range []string{HashBcrypt, HashAPR1, HashCrypt} {
+		if !auth(username, "password", "") {
+			t.Errorf("False negative for %s", username)
+		}
+	}
+	if !auth(HashPlain, "secret", "") {
+		t.Errorf("False negative for %s", HashPlain)
+	}
+	if auth(HashSHA1, "password", "") {
+		t.Errorf("False positive for deleted user")
+	}
+}
+
+func TestHtdigestFileConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Separate instances simulate separate processes
+	path := filepath.Join(dir, "htdigest")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f := HtdigestFile{path}
+			if err := f.Add(string(rune('a'+i)), "golang", "password"); err != nil {
+				t.Errorf("Error:  %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := (&HtdigestFile{path}).List("golang")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(users) != 10 {
+		t.Errorf("Lost concurrent edits: %v", users)
+	}
+}
+
+func TestCredentialFileDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Deleting from a missing file must not create the file
+	path := filepath.Join(dir, "htpasswd")
+	if err := (&HtpasswdFile{Path: path}).Delete("user"); err != ErrUserNotFound {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := (&HtdigestFile{path}).Delete("user", "golang"); err != ErrUserNotFound {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Created the file: %v", err)
+	}
+
+	// Comments are never matched
+	data := "#x:golang:comment\n#x:comment\nx:golang:0123\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := (&HtpasswdFile{Path: path}).Delete("#x"); err != ErrInvalidName {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := (&HtdigestFile{path}).Delete("#x", "golang"); err != ErrInvalidName {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := (&HtdigestFile{path}).Delete("x", "golang"); err != nil {
+		t.Errorf("Error:  %s", err)
+	}
+	if buffer, err := ioutil.ReadFile(path); err != nil || string(buffer) != "#x:golang:comment\n#x:comment\n" {
+		t.Errorf("Incorrect file: %q", buffer)
+	}
+}
+
+func TestCredentialFileInvalidNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Names that the readers would reject or change must not be added
+	path := filepath.Join(dir, "htdigest")
+	digest := HtdigestFile{path}
+	if err := digest.Add("user", "golang", "password"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	for _, v := range []struct{ username, realm string }{
+		{`bo"b`, "golang"},
+		{"user", `go"lang`},
+		{" bob", "golang"},
+		{"bob", "\tgolang"},
+		{"#bob", "golang"},
+		{"bo:b", "golang"},
+	} {
+		if err := digest.Add(v.username, v.realm, "password"); err != ErrInvalidName {
+			t.Errorf("Incorrect error for %q %q: %v", v.username, v.realm, err)
+		}
+	}
+	lookup, err := OpenHtdigest(path, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if lookup("user", "golang") == "" {
+		t.Errorf("Missing user")
+	}
+
+	path = filepath.Join(dir, "htpasswd")
+	passwd := HtpasswdFile{path, HashPlain}
+	if err := passwd.Add(`bo"b`, "password"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := passwd.Add(" bob", "password"); err != ErrInvalidName {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	auth, err := OpenHtpasswd(path, nil)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if !auth(`bo"b`, "password", "") {
+		t.Errorf("False negative for quoted username")
+	}
+}
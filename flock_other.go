@@ -0,0 +1,22 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package httpauth
+
+import (
+	"os"
+)
+
+// File locking is not supported on this platform.  Concurrent edits from
+// separate processes may be lost, but files are still replaced atomically.
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,383 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// The following variables are used to specify error conditions when
+// parsing authentication headers.
+var (
+	ErrMalformedHeader = errors.New("The authentication header was malformed.")
+	ErrDuplicateParam  = errors.New("The authentication header repeated a parameter.")
+)
+
+// Credentials contain the information sent by a client in the header
+// Authorization (RFC 7235, section 4.2).  Depending on the scheme, the
+// credentials contain either a token68 or a list of parameters.
+type Credentials struct {
+	// Scheme names the authentication scheme.  Scheme names are not
+	// case-sensitive, so callers should compare using strings.EqualFold.
+	Scheme string
+	// Token68 holds the credentials for schemes that use a single token,
+	// such as the basic authentication scheme.
+	Token68 string
+	// Params holds the credentials for schemes that use parameters.  The
+	// names of the parameters have been converted to lower-case, and
+	// quoted values have been unescaped.
+	Params map[string]string
+}
+
+// A Challenge contains the information sent by a server in the header
+// WWW-Authenticate (RFC 7235, section 4.1).  A single header can hold
+// multiple challenges.
+type Challenge struct {
+	// Scheme names the authentication scheme.  Scheme names are not
+	// case-sensitive, so callers should compare using strings.EqualFold.
+	Scheme string
+	// Token68 holds the challenge for schemes that use a single token.
+	Token68 string
+	// Params holds the parameters of the challenge.  The names of the
+	// parameters have been converted to lower-case, and quoted values
+	// have been unescaped.
+	Params map[string]string
+}
+
+// ParseCredentials parses the value of an Authorization header.
+func ParseCredentials(header string) (*Credentials, error) {
+	p := authParser{s: header}
+	p.skipSpace()
+	scheme, token68, params, err := p.parseScheme()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, ErrMalformedHeader
+	}
+	return &Credentials{scheme, token68, params}, nil
+}
+
+// ParseChallenges parses the value of a WWW-Authenticate header, which is
+// a comma separated list of challenges.
+func ParseChallenges(header string) ([]Challenge, error) {
+	var ret []Challenge
+
+	p := authParser{s: header}
+	for {
+		p.skipSpaceAndCommas()
+		if p.eof() {
+			break
+		}
+		scheme, token68, params, err := p.parseScheme()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Challenge{scheme, token68, params})
+
+		p.skipSpace()
+		if !p.eof() && p.peek() != ',' {
+			return nil, ErrMalformedHeader
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, ErrMalformedHeader
+	}
+	return ret, nil
+}
+
+// ParseAuthParams parses a comma separated list of parameters, such as
+// the value of an Authentication-Info header (RFC 7615).
+func ParseAuthParams(header string) (map[string]string, error) {
+	p := authParser{s: header}
+	params, err := p.parseParams(false)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaceAndCommas()
+	if !p.eof() {
+		return nil, ErrMalformedHeader
+	}
+	return params, nil
+}
+
+// String formats the credentials as the value of an Authorization header.
+// Parameters are sorted by name.
+func (c *Credentials) String() string {
+	return formatAuth(c.Scheme, c.Token68, c.Params, digestCredentialsTokens)
+}
+
+// String formats the challenge for a WWW-Authenticate header.  Parameters
+// are sorted by name.
+func (c *Challenge) String() string {
+	return formatAuth(c.Scheme, c.Token68, c.Params, digestChallengeTokens)
+}
+
+// The following variables list the parameters of the digest scheme whose
+// values are tokens, which strict implementations require to be unquoted
+// (RFC 7616, sections 3.3 and 3.4).
+var (
+	digestChallengeTokens   = map[string]bool{"algorithm": true, "stale": true, "charset": true, "userhash": true}
+	digestCredentialsTokens = map[string]bool{"algorithm": true, "qop": true, "nc": true, "userhash": true}
+)
+
+// The function formatAuth formats a challenge or credentials.  Parameter
+// values are quoted, except for parameters of the digest scheme listed in
+// tokens, provided that their values are valid tokens.
+func formatAuth(scheme, token68 string, params map[string]string, tokens map[string]bool) string {
+	if token68 != "" {
+		return scheme + " " + token68
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := scheme
+	for i, name := range names {
+		if i == 0 {
+			ret += " "
+		} else {
+			ret += ", "
+		}
+		if value := params[name]; tokens[name] && strings.EqualFold(scheme, "Digest") && isToken(value) {
+			ret += name + "=" + value
+		} else {
+			ret += name + "=" + quoteString(value)
+		}
+	}
+	return ret
+}
+
+// The function isToken returns whether or not the value is a non-empty
+// token, which can be written without quotes.
+func isToken(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if !isTokenChar(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// The function quoteString formats the value as a quoted-string, escaping
+// any quotes or backslashes.
+func quoteString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isToken68Char(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~+/", c) >= 0
+}
+
+// The function isQuotedChar returns whether the character may appear in a
+// quoted-string, either directly (qdtext) or escaped (quoted-pair).
+func isQuotedChar(c byte) bool {
+	return c == '\t' || c == ' ' || (0x21 <= c && c != 0x7f)
+}
+
+// An authParser holds the state while parsing an authentication header.
+type authParser struct {
+	s   string
+	pos int
+}
+
+func (p *authParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *authParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *authParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *authParser) skipSpaceAndCommas() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == ',') {
+		p.pos++
+	}
+}
+
+func (p *authParser) parseToken() string {
+	start := p.pos
+	for !p.eof() && isTokenChar(p.peek()) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *authParser) parseQuotedString() (string, error) {
+	// Skip the opening quote
+	p.pos++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\':
+			if p.eof() || !isQuotedChar(p.peek()) {
+				return "", ErrMalformedHeader
+			}
+			b.WriteByte(p.peek())
+			p.pos++
+		case isQuotedChar(c):
+			b.WriteByte(c)
+		default:
+			return "", ErrMalformedHeader
+		}
+	}
+	return "", ErrMalformedHeader
+}
+
+// The function parseToken68 attempts to read a token68, which must be
+// followed by the end of the header or a comma.  If there is no token68,
+// the position is not changed.
+func (p *authParser) parseToken68() string {
+	start := p.pos
+	for !p.eof() && isToken68Char(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return ""
+	}
+	for !p.eof() && p.peek() == '=' {
+		p.pos++
+	}
+	end := p.pos
+	p.skipSpace()
+	if !p.eof() && p.peek() != ',' {
+		p.pos = start
+		return ""
+	}
+	return p.s[start:end]
+}
+
+// The function parseScheme reads an authentication scheme, and the
+// token68 or list of parameters that follow.
+func (p *authParser) parseScheme() (scheme, token68 string, params map[string]string, err error) {
+	scheme = p.parseToken()
+	if scheme == "" {
+		return "", "", nil, ErrMalformedHeader
+	}
+
+	// The scheme can stand alone
+	if p.eof() || p.peek() == ',' {
+		return scheme, "", map[string]string{}, nil
+	}
+	if p.peek() != ' ' {
+		return "", "", nil, ErrMalformedHeader
+	}
+	p.skipSpace()
+	if p.eof() || p.peek() == ',' {
+		return scheme, "", map[string]string{}, nil
+	}
+
+	if token68 = p.parseToken68(); token68 != "" {
+		return scheme, token68, map[string]string{}, nil
+	}
+
+	params, err = p.parseParams(true)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return scheme, "", params, nil
+}
+
+// The function parseParams reads a list of parameters.  When reading a
+// list of challenges, the list ends when an element is not a parameter,
+// since it must be the start of the next challenge.
+func (p *authParser) parseParams(inChallenge bool) (map[string]string, error) {
+	params := make(map[string]string)
+
+	for {
+		p.skipSpaceAndCommas()
+		if p.eof() {
+			return params, nil
+		}
+
+		start := p.pos
+		name := p.parseToken()
+		if name == "" {
+			return nil, ErrMalformedHeader
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != '=' {
+			if inChallenge && len(params) > 0 {
+				// This is the scheme for the next challenge.  Rewind
+				// to the comma that precedes it.
+				p.pos = start
+				for p.pos > 0 && p.s[p.pos-1] != ',' {
+					p.pos--
+				}
+				p.pos--
+				return params, nil
+			}
+			return nil, ErrMalformedHeader
+		}
+		p.pos++
+		p.skipSpace()
+
+		var value string
+		if !p.eof() && p.peek() == '"' {
+			var err error
+			if value, err = p.parseQuotedString(); err != nil {
+				return nil, err
+			}
+		} else {
+			value = p.parseToken()
+			if value == "" {
+				return nil, ErrMalformedHeader
+			}
+		}
+
+		name = strings.ToLower(name)
+		if _, ok := params[name]; ok {
+			return nil, ErrDuplicateParam
+		}
+		params[name] = value
+
+		p.skipSpace()
+		if !p.eof() && p.peek() != ',' {
+			return nil, ErrMalformedHeader
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseCredentials(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected *Credentials
+	}{
+		{"Basic dXNlcjpwYXNz", &Credentials{"Basic", "dXNlcjpwYXNz", map[string]string{}}},
+		{"basic   dXNlcjpwYXNz==  ", &Credentials{"basic", "dXNlcjpwYXNz==", map[string]string{}}},
+		{"Bearer", &Credentials{"Bearer", "", map[string]string{}}},
+		{`Digest username="a, b", Realm=golang,nc=00000001`, &Credentials{"Digest", "", map[string]string{
+			"username": "a, b", "realm": "golang", "nc": "00000001"}}},
+		{`Digest username="say \"hi\" \\ bye"`, &Credentials{"Digest", "", map[string]string{
+			"username": `say "hi" \ bye`}}},
+		{`Digest a = "" , b=c`, &Credentials{"Digest", "", map[string]string{"a": "", "b": "c"}}},
+		{"", nil},
+		{" ", nil},
+		{"Basic dXNlcjpwYXNz junk", nil},
+		{`Digest username="unterminated`, nil},
+		{`Digest username="bad\`, nil},
+		{`Digest a=b, a=c`, nil},
+		{`Digest a=b c`, nil},
+		{`Digest a=, b=c`, nil},
+		{`Digest a=b, Basic c=d`, nil},
+		{"Basic\tdXNlcjpwYXNz", nil},
+	}
+
+	for i, v := range cases {
+		credentials, err := ParseCredentials(v.header)
+		if v.expected == nil {
+			if err == nil {
+				t.Errorf("Case %d: parsed malformed header: %q", i, v.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %d: error: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(credentials, v.expected) {
+			t.Errorf("Case %d: incorrect credentials: %v", i, credentials)
+		}
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	// Example from RFC 7235, section 4.1
+	header := `Newauth realm="apps", type=1,  title="Login to \"apps\"", Basic realm="simple"`
+	expected := []Challenge{
+		{"Newauth", "", map[string]string{"realm": "apps", "type": "1", "title": `Login to "apps"`}},
+		{"Basic", "", map[string]string{"realm": "simple"}},
+	}
+
+	challenges, err := ParseChallenges(header)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if !reflect.DeepEqual(challenges, expected) {
+		t.Errorf("Incorrect challenges: %v", challenges)
+	}
+
+	challenges, err = ParseChallenges("Negotiate, Bearer abc=, Basic realm=x")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(challenges) != 3 || challenges[0].Scheme != "Negotiate" ||
+		challenges[1].Token68 != "abc=" || challenges[2].Params["realm"] != "x" {
+		t.Errorf("Incorrect challenges: %v", challenges)
+	}
+
+	if _, err = ParseChallenges(" , "); err == nil {
+		t.Errorf("Parsed empty list of challenges.")
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	params, err := ParseAuthParams(`rspauth="abc", cnonce="x,y", nc=00000001`)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if !reflect.DeepEqual(params, map[string]string{"rspauth": "abc", "cnonce": "x,y", "nc": "00000001"}) {
+		t.Errorf("Incorrect parameters: %v", params)
+	}
+
+	if _, err = ParseAuthParams(`rspauth="abc" nc`); err == nil {
+		t.Errorf("Parsed malformed parameters.")
+	}
+}
+
+func TestBasicSchemeCase(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "bAsIc dXNlcjp1c2Vy")
+	if username := basicAuth.Authorize(r); username != "user" {
+		t.Errorf("Incorrect username: %s", username)
+	}
+
+	r.Header.Set("Authorization", "Basicx dXNlcjp1c2Vy")
+	if username := basicAuth.Authorize(r); username != "" {
+		t.Errorf("Accepted incorrect scheme.")
+	}
+}
+
+func TestCredentialsString(t *testing.T) {
+	credentials := Credentials{Scheme: "Digest", Params: map[string]string{
+		"username": `a "b" \c`, "nc": "1"}}
+	if s := credentials.String(); s != `Digest nc=1, username="a \"b\" \\c"` {
+		t.Errorf("Incorrect string: %s", s)
+	}
+
+	r := &http.Request{Header: http.Header{"Authorization": {credentials.String()}}}
+	if params := parseDigestAuthHeader(r); !reflect.DeepEqual(params, credentials.Params) {
+		t.Errorf("Incorrect parameters: %v", params)
+	}
+}
+
+func TestFormatAuthTokens(t *testing.T) {
+	credentials := Credentials{Scheme: "Digest", Params: map[string]string{
+		"algorithm": "SHA-256", "qop": "auth", "nc": "00000001", "realm": "golang", "cnonce": "abc"}}
+	if s := credentials.String(); s != `Digest algorithm=SHA-256, cnonce="abc", nc=00000001, qop=auth, realm="golang"` {
+		t.Errorf("Incorrect credentials: %s", s)
+	}
+
+	challenge := Challenge{Scheme: "Digest", Params: map[string]string{
+		"algorithm": "MD5", "qop": "auth,auth-int", "stale": "TRUE", "realm": "golang"}}
+	if s := challenge.String(); s != `Digest algorithm=MD5, qop="auth,auth-int", realm="golang", stale=TRUE` {
+		t.Errorf("Incorrect challenge: %s", s)
+	}
+
+	// Only the digest scheme is affected, and values that are not tokens
+	// are still quoted
+	credentials = Credentials{Scheme: "Other", Params: map[string]string{"qop": "auth"}}
+	if s := credentials.String(); s != `Other qop="auth"` {
+		t.Errorf("Incorrect credentials: %s", s)
+	}
+	credentials = Credentials{Scheme: "Digest", Params: map[string]string{"qop": "", "nc": "a b"}}
+	if s := credentials.String(); s != `Digest nc="a b", qop=""` {
+		t.Errorf("Incorrect credentials: %s", s)
+	}
+}
+
+func FuzzParseCredentials(f *testing.F) {
+	f.Add("Basic dXNlcjpwYXNz")
+	f.Add(`Digest username="a, b", realm=golang, nc=00000001`)
+	f.Add(`Digest username="say \"hi\""`)
+	f.Add("Bearer abc==")
+
+	f.Fuzz(func(t *testing.T, header string) {
+		credentials, err := ParseCredentials(header)
+		if err != nil {
+			return
+		}
+
+		// Formatting the credentials and parsing again must give the same result
+		again, err := ParseCredentials(credentials.String())
+		if err != nil {
+			t.Fatalf("Could not parse formatted credentials %q: %s", credentials.String(), err)
+		}
+		if !reflect.DeepEqual(credentials, again) {
+			t.Errorf("Round trip changed credentials: %v != %v", credentials, again)
+		}
+	})
+}
+
+func FuzzParseChallenges(f *testing.F) {
+	f.Add(`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`)
+	f.Add("Negotiate, Bearer abc=, Basic realm=x")
+	f.Add(`Digest realm="golang", qop="auth,auth-int", algorithm=SHA-256`)
+
+	f.Fuzz(func(t *testing.T, header string) {
+		challenges, err := ParseChallenges(header)
+		if err != nil {
+			return
+		}
+
+		formatted := ""
+		for i := range challenges {
+			if i > 0 {
+				formatted += ", "
+			}
+			formatted += challenges[i].String()
+		}
+		again, err := ParseChallenges(formatted)
+		if err != nil {
+			t.Fatalf("Could not parse formatted challenges %q: %s", formatted, err)
+		}
+		if !reflect.DeepEqual(challenges, again) {
+			t.Errorf("Round trip changed challenges: %v != %v", challenges, again)
+		}
+	})
+}
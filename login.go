@@ -0,0 +1,208 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// The constant maxLoginBodySize limits the size of the credentials sent to
+// the login handler.
+const maxLoginBodySize = 64 << 10
+
+// LoginOptions control the handlers returned by LoginHandler and
+// LogoutHandler.  A nil *LoginOptions is equivalent to the zero value.
+type LoginOptions struct {
+	// SuccessURL is where clients are redirected after logging in, unless
+	// the policy's ReturnURL provides the URL they originally requested.  If
+	// empty, clients are redirected to '/'.
+	SuccessURL string
+	// LogoutURL is where clients are redirected after logging out.  If
+	// empty, clients are redirected to the policy's LoginPage.
+	LogoutURL string
+	// UsernameField and PasswordField name the form fields, or the members
+	// of a JSON object, that hold the credentials.  If empty, 'username'
+	// and 'password' are used.
+	UsernameField string
+	PasswordField string
+	// Template renders the login page.  It is executed with a
+	// *LoginPageData.
+	Template *template.Template
+	// WriteLoginPage renders the login page when Template is nil.  The error
+	// message, if any, can be retrieved using LoginErrorFromContext.  If
+	// both are nil, a basic form is rendered.
+	WriteLoginPage HtmlWriter
+}
+
+// LoginPageData holds the data used to render a login page.
+type LoginPageData struct {
+	// Error describes why the last login failed, or is empty.
+	Error string
+	// Username is the username from the last login, so that the form can
+	// be filled in again.
+	Username string
+}
+
+var defaultLoginTemplate = template.Must(template.New("login").Parse(`<html><head><title>Login</title></head><body>
+{{if .Error}}<p class="error">{{.Error}}</p>
+{{end}}<form method="POST">
+<label>Username <input name="username" value="{{.Username}}"></label>
+<label>Password <input name="password" type="password"></label>
+<input type="submit" value="Login">
+</form>
+</body></html>
+`))
+
+const loginErrorKey contextKey = 2
+
+// LoginErrorFromContext returns the error message for a failed login
+// attached to the context by the login handler, if any.
+func LoginErrorFromContext(ctx context.Context) string {
+	msg, _ := ctx.Value(loginErrorKey).(string)
+	return msg
+}
+
+type loginHandler struct {
+	auth    *Cookie
+	options LoginOptions
+}
+
+// LoginHandler returns a handler for the login page.  For GET requests, the
+// login page is rendered.  For POST requests, the credentials are read from
+// the form, or from a JSON object if the content type is application/json,
+// and checked using Login.  If successful, the client is redirected to the
+// URL returned by ReturnURL, or to the SuccessURL.  Otherwise, the login
+// page is rendered again with an error message, or, for JSON requests, a
+// JSON object with the member 'error' is returned.
+func (a *Cookie) LoginHandler(options *LoginOptions) http.Handler {
+	h := &loginHandler{auth: a}
+	if options != nil {
+		h.options = *options
+	}
+	if h.options.SuccessURL == "" {
+		h.options.SuccessURL = "/"
+	}
+	if h.options.UsernameField == "" {
+		h.options.UsernameField = "username"
+	}
+	if h.options.PasswordField == "" {
+		h.options.PasswordField = "password"
+	}
+	return h
+}
+
+func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		h.writeLoginPage(w, r, http.StatusOK, &LoginPageData{})
+		return
+	case "POST":
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	isJSON := false
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		isJSON = mediaType == "application/json"
+	}
+
+	username, password, err := h.readCredentials(r, isJSON)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if username == "" {
+		err = ErrBadUsernameOrPassword
+	} else {
+		err = h.auth.Login(w, username, password)
+	}
+	switch {
+	case err == nil:
+		http.Redirect(w, r, h.auth.ReturnURL(r, h.options.SuccessURL), http.StatusSeeOther)
+	case err == ErrBadUsernameOrPassword || err == ErrTooManySessions:
+		if isJSON {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		h.writeLoginPage(w, r, http.StatusUnauthorized, &LoginPageData{err.Error(), username})
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// The function readCredentials returns the username and password from the
+// body of the request.
+func (h *loginHandler) readCredentials(r *http.Request, isJSON bool) (username, password string, err error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxLoginBodySize)
+
+	if isJSON {
+		var fields map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			return "", "", err
+		}
+		username, _ = fields[h.options.UsernameField].(string)
+		password, _ = fields[h.options.PasswordField].(string)
+		return username, password, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return "", "", err
+	}
+	return r.PostForm.Get(h.options.UsernameField), r.PostForm.Get(h.options.PasswordField), nil
+}
+
+func (h *loginHandler) writeLoginPage(w http.ResponseWriter, r *http.Request, code int, data *LoginPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if r.Method == "HEAD" {
+		return
+	}
+
+	switch {
+	case h.options.Template != nil:
+		h.options.Template.Execute(w, data)
+	case h.options.WriteLoginPage != nil:
+		r = r.WithContext(context.WithValue(r.Context(), loginErrorKey, data.Error))
+		h.options.WriteLoginPage(w, r)
+	default:
+		defaultLoginTemplate.Execute(w, data)
+	}
+}
+
+// LogoutHandler returns a handler that calls Logout, and then redirects the
+// client to the LogoutURL.  Only POST requests are accepted, so that other
+// sites cannot logout clients using links or images.
+func (a *Cookie) LogoutHandler(options *LoginOptions) http.Handler {
+	url := a.LoginPage
+	if options != nil && options.LogoutURL != "" {
+		url = options.LogoutURL
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := a.Logout(w, r); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// Drain the body so that the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(r.Body, maxLoginBodySize))
+		http.Redirect(w, r, url, http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoginHandler(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	handler := policy.LoginHandler(&LoginOptions{SuccessURL: "/home"})
+
+	cases := []struct {
+		contentType string
+		body        string
+		code        int
+		contains    string
+	}{
+		{"application/x-www-form-urlencoded", url.Values{"username": {"user1"}, "password": {"user1"}}.Encode(), http.StatusSeeOther, ""},
+		{"application/x-www-form-urlencoded", url.Values{"username": {"<user1>"}, "password": {"bad"}}.Encode(), http.StatusUnauthorized, "&lt;user1&gt;"},
+		{"application/json", `{"username":"user1","password":"user1"}`, http.StatusSeeOther, ""},
+		{"application/json; charset=utf-8", `{"username":"user1","password":"bad"}`, http.StatusUnauthorized, `"error":"Bad username or password."`},
+		{"application/json", `{"username":`, http.StatusBadRequest, ""},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(v.body))
+		r.Header.Set("Content-Type", v.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != v.code {
+			t.Errorf("Case %d:  Unexpected status code, got %d", i, w.Code)
+		}
+		if v.code == http.StatusSeeOther {
+			if loc := w.Header().Get("Location"); loc != "/home" {
+				t.Errorf("Case %d:  Unexpected redirect, got %s", i, loc)
+			}
+			if len(w.Result().Cookies()) != 1 {
+				t.Errorf("Case %d:  Expected a session cookie", i)
+			}
+		}
+		if body := w.Body.String(); !strings.Contains(body, v.contains) {
+			t.Errorf("Case %d:  Unexpected body, got %s", i, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<form") {
+		t.Errorf("Expected the login page, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/login", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code, got %d", w.Code)
+	}
+}
+
+func TestLoginHandlerPage(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+
+	tmpl := template.Must(template.New("login").Parse(`error={{.Error}} username={{.Username}}`))
+	writer := func(w io.Writer, r *http.Request) {
+		io.WriteString(w, "error="+LoginErrorFromContext(r.Context()))
+	}
+
+	cases := []struct {
+		options  *LoginOptions
+		expected string
+	}{
+		{&LoginOptions{Template: tmpl}, "error=Bad username or password. username=user1"},
+		{&LoginOptions{WriteLoginPage: writer}, "error=Bad username or password."},
+		{&LoginOptions{UsernameField: "u", PasswordField: "p", Template: tmpl}, "error=Bad username or password. username="},
+	}
+
+	for i, v := range cases {
+		body := url.Values{"username": {"user1"}, "password": {"bad"}}.Encode()
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		policy.LoginHandler(v.options).ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Case %d:  Unexpected status code, got %d", i, w.Code)
+		}
+		if body := w.Body.String(); body != v.expected {
+			t.Errorf("Case %d:  Unexpected body, got %s", i, body)
+		}
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	handler := policy.LogoutHandler(&LoginOptions{LogoutURL: "/bye"})
+
+	nonce, err := policy.createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	r := httptest.NewRequest("GET", "/logout", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: nonce})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest("POST", "/logout", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: nonce})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/bye" {
+		t.Errorf("Unexpected response, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if session, _ := policy.Sessions.Lookup(nonce); session != nil {
+		t.Errorf("Session was not destroyed")
+	}
+}
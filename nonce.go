@@ -5,13 +5,20 @@
 package httpauth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"time"
 )
 
 const (
 	// The length of a nonce
 	nonceLen = 16
+	// The length of the random and signature parts of a signed nonce
+	signedNonceRandLen = 8
+	signedNonceMacLen  = 16
 )
 
 func createNonce() (string, error) {
@@ -26,3 +33,46 @@ func createNonce() (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(buffer[0:]), nil
 }
+
+func signNonce(key []byte, realm string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(realm))
+	mac.Write(payload)
+	return mac.Sum(nil)[:signedNonceMacLen]
+}
+
+// The function createSignedNonce creates a nonce that encodes the time
+// when it was issued, and that is signed using the key.  The nonce can
+// later be verified without keeping any state on the server.
+func createSignedNonce(key []byte, realm string, now time.Time) (string, error) {
+	var buffer [8 + signedNonceRandLen + signedNonceMacLen]byte
+
+	binary.BigEndian.PutUint64(buffer[0:8], uint64(now.UnixNano()))
+	for i := 8; i < 8+signedNonceRandLen; {
+		n, err := rand.Read(buffer[i : 8+signedNonceRandLen])
+		if err != nil {
+			return "", err
+		}
+		i += n
+	}
+	copy(buffer[8+signedNonceRandLen:], signNonce(key, realm, buffer[:8+signedNonceRandLen]))
+	return base64.StdEncoding.EncodeToString(buffer[0:]), nil
+}
+
+// The function verifySignedNonce checks that the nonce was signed using one
+// of the keys, and returns the time when the nonce was issued.  Multiple
+// keys are accepted so that keys can be rotated.
+func verifySignedNonce(keys [][]byte, realm, nonce string) (issued time.Time, ok bool) {
+	buffer, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil || len(buffer) != 8+signedNonceRandLen+signedNonceMacLen {
+		return time.Time{}, false
+	}
+
+	payload, sig := buffer[:8+signedNonceRandLen], buffer[8+signedNonceRandLen:]
+	for _, key := range keys {
+		if hmac.Equal(sig, signNonce(key, realm, payload)) {
+			return time.Unix(0, int64(binary.BigEndian.Uint64(payload))), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -5,19 +5,17 @@
 package persona
 
 import (
-	"container/heap"
 	"errors"
 	"html"
 	"net/http"
-	"sync"
 	"time"
+
+	"github.com/saintfish/httpauth-go"
 )
 
 const (
 	// The default value for ClientCacheResidence used when creating new Digest instances.
 	DefaultClientCacheResidence = 1 * time.Hour
-	// The cookie name used to store authorization information
-	cookieName = "Authorization"
 )
 
 var (
@@ -25,42 +23,6 @@ var (
 	ErrInvalidToken          = errors.New("The session token was invalid.")
 )
 
-type clientInfo struct {
-	username    string // username for this authorized connection
-	lastContact int64  // time of last communication with this client (unix nanoseconds)
-	nonce       string // unique per client salt
-}
-
-type priorityQueue []*clientInfo
-
-func (pq priorityQueue) Len() int {
-	return len(pq)
-}
-
-func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].lastContact < pq[j].lastContact
-}
-
-func (pq priorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-}
-
-func (pq *priorityQueue) Push(x interface{}) {
-	*pq = append(*pq, x.(*clientInfo))
-}
-
-func (pq *priorityQueue) Pop() interface{} {
-	n := len(*pq)
-	ret := (*pq)[n-1]
-	*pq = (*pq)[:n-1]
-	return ret
-}
-
-func (pq priorityQueue) MinValue() int64 {
-	n := len(pq)
-	return pq[n-1].lastContact
-}
-
 // A Policy is an authentication policy (in the sense of the httpauth package) for authenticating
 // users.  The policy verifies that users credentials using Mozilla's Persona, and
 // then setting a cookie stored on the client to verify authorized clients.  This
@@ -73,14 +35,14 @@ type Policy struct {
 	LoginPage string
 	// Path sets the scope of the authorization cookie
 	Path string
+	// CookieOptions sets the other attributes of the authorization cookie.
+	CookieOptions httpauth.CookieOptions
 
 	// CientCacheResidence controls how long client information is retained
 	ClientCacheResidence time.Duration
-
-	mutex          sync.Mutex
-	clientsByNonce map[string]*clientInfo
-	clientsByUser  map[string]*clientInfo
-	lru            priorityQueue
+	// Sessions holds the sessions of clients that have logged in.  The
+	// same stores can be used as for the Cookie policy of package httpauth.
+	Sessions httpauth.SessionStore
 }
 
 // NewPolicy creates a new authentication policy that uses Mozilla's Persona.
@@ -89,23 +51,9 @@ func NewPolicy(realm, url string) *Policy {
 		realm,
 		url,
 		"/",
+		httpauth.CookieOptions{},
 		DefaultClientCacheResidence,
-		sync.Mutex{},
-		make(map[string]*clientInfo),
-		make(map[string]*clientInfo),
-		nil}
-}
-
-func (a *Policy) evictLeastRecentlySeen() {
-	now := time.Now().UnixNano()
-
-	// Remove all entries from the client cache older than the
-	// residence time.
-	for len(a.lru) > 0 && a.lru.MinValue()+a.ClientCacheResidence.Nanoseconds() <= now {
-		client := heap.Pop(&a.lru).(*clientInfo)
-		delete(a.clientsByNonce, client.nonce)
-		delete(a.clientsByUser, client.username)
-	}
+		httpauth.NewMemoryStore()}
 }
 
 // Authorize retrieves the credientials from the HTTP request, and
@@ -114,22 +62,14 @@ func (a *Policy) evictLeastRecentlySeen() {
 // invalid, or a system error prevented verification.
 func (a *Policy) Authorize(r *http.Request) (username string) {
 	// Find the nonce used to identify a client
-	token, err := r.Cookie(cookieName)
+	token, err := r.Cookie(a.CookieOptions.CookieName())
 	if err != nil || token.Value == "" {
 		return ""
 	}
-	if len(token.Value) != nonceLen {
-		return ""
-	}
-
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
 
 	// Do we have a client with that nonce?
-	if client, ok := a.clientsByNonce[token.Value]; ok {
-		client.lastContact = time.Now().UnixNano()
-		return client.username
+	if session, err := a.Sessions.Lookup(token.Value); err == nil && session != nil {
+		return session.Username
 	}
 	return ""
 }
@@ -153,13 +93,9 @@ func (a *Policy) NotifyAuthRequired(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(note))
 	}
 
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// Check for old clientInfo, and evict those older than
-	// residence time.
-	a.evictLeastRecentlySeen()
+	// Check for old sessions, and evict those older than residence time.
+	// Errors are ignored, as the eviction will be retried.
+	a.Sessions.Expire(time.Now().Add(-a.ClientCacheResidence), time.Time{})
 }
 
 // The function createSession creates a client entry.  The nonce can be
@@ -172,27 +108,23 @@ func (a *Policy) NotifyAuthRequired(w http.ResponseWriter, r *http.Request) {
 // The credentials are assumed to be verified.  They are not validated
 // before creating the session.
 func (a *Policy) createSession(user *User) (nonce string, err error) {
-	// Create an entry for this user
-	nonce, err = createNonce()
+	// Check if there is already a session for this username
+	sessions, err := a.Sessions.List(user.Email)
 	if err != nil {
 		return "", err
 	}
-
-	// Lock before mutating the fields of the policy
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// Check if there is already a session for this username
-	if ci, ok := a.clientsByUser[user.Email]; ok {
-		ci.lastContact = time.Now().UnixNano()
-		return ci.nonce, nil
+	if len(sessions) > 0 {
+		if session, err := a.Sessions.Lookup(sessions[0].ID); err != nil || session != nil {
+			return sessions[0].ID, err
+		}
 	}
 
-	ci := &clientInfo{user.Email, time.Now().UnixNano(), nonce}
-	a.clientsByNonce[nonce] = ci
-	a.clientsByUser[user.Email] = ci
-
-	return nonce, nil
+	// Create an entry for this user
+	session, err := a.Sessions.Create(user.Email)
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
 }
 
 // Login creates a session for the user, and then a cookie is set on the
@@ -215,7 +147,7 @@ func (a *Policy) Login(w http.ResponseWriter, user *User) error {
 		return err
 	}
 
-	http.SetCookie(w, &http.Cookie{Name: cookieName, Value: nonce, Path: a.Path, HttpOnly: true})
+	http.SetCookie(w, a.CookieOptions.NewCookie(a.Path, nonce))
 	return nil
 }
 
@@ -224,18 +156,8 @@ func (a *Policy) Login(w http.ResponseWriter, user *User) error {
 // Note, this does not complete the logout on the client side.  The current
 // Persona could easily reauthorize the user, so a complete logout will require
 // action by the client as well, such as calling navigator.id.logout().
-func (a *Policy) destroySession(nonce string) {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// Do we have a client with that nonce?
-	if client, ok := a.clientsByNonce[nonce]; ok {
-		// remove client info from maps
-		delete(a.clientsByNonce, nonce)
-		delete(a.clientsByUser, client.username)
-		// client info is still in the priority queue
-		// however, it will be removed in due time when it expires
-	}
+func (a *Policy) destroySession(nonce string) error {
+	return a.Sessions.Delete(nonce)
 }
 
 // Logout ensures that the session associated with the HTTP request
@@ -255,13 +177,16 @@ func (a *Policy) destroySession(nonce string) {
 // action by the client as well, such as calling navigator.id.logout().
 func (a *Policy) Logout(w http.ResponseWriter, r *http.Request) error {
 	// Find the nonce used to identify a client
-	token, err := r.Cookie("Authorization")
+	token, err := r.Cookie(a.CookieOptions.CookieName())
 	if err == nil && token.Value != "" {
 		// Invalidate the nonce
-		a.destroySession(token.Value)
+		err = a.destroySession(token.Value)
+	} else {
+		err = nil
 	}
 
-	// Clear the cookie from the client
-	http.SetCookie(w, &http.Cookie{Name: "Authorization", Value: "", Path: a.Path, Expires: time.Unix(0, 0)})
-	return nil
+	// Clear the cookie from the client, even if the session could not be
+	// removed from the store
+	http.SetCookie(w, a.CookieOptions.ExpiredCookie(a.Path))
+	return err
 }
@@ -164,7 +164,7 @@ func TestPersonaLogin(t *testing.T) {
 		t.Fatalf("Error:  %s", err)
 	}
 
-	if _, ok := personaAuth.clientsByNonce[nonce1]; !ok {
+	if session, _ := personaAuth.Sessions.Lookup(nonce1); session == nil {
 		t.Fatalf("Could not find nonce in the map of sessions.")
 	}
 
@@ -192,8 +192,10 @@ func TestPersonaLogout(t *testing.T) {
 		t.Fatalf("Error:  %s", err)
 	}
 
-	personaAuth.destroySession(nonce)
-	if _, ok := personaAuth.clientsByNonce[nonce]; ok {
+	if err := personaAuth.destroySession(nonce); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if session, _ := personaAuth.Sessions.Lookup(nonce); session != nil {
 		t.Fatalf("destroySession failed to remove client for the nonce.")
 	}
 }
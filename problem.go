@@ -0,0 +1,74 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A problem holds the details of an error, as described by RFC 7807, which
+// are sent to API clients in place of an HTML page.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Login is an extension member that holds the URL of the login page.
+	Login string `json:"login,omitempty"`
+}
+
+// The function writeProblem writes the problem to the HTTP response, using
+// the status from the problem.
+func writeProblem(w http.ResponseWriter, p *problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// The function acceptsJSON returns whether or not the client prefers JSON to
+// HTML, based on the Accept header of the request.  Wildcards are ignored,
+// as browsers accept all types.
+func acceptsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+	for _, header := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+
+			switch mediaType {
+			case "application/json", "application/problem+json":
+				if q > jsonQ {
+					jsonQ = q
+				}
+			case "text/html":
+				if q > htmlQ {
+					htmlQ = q
+				}
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ >= htmlQ
+}
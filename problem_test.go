@@ -0,0 +1,38 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsJSON(t *testing.T) {
+	cases := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/json, text/plain, */*", true},
+		{"text/html;q=0.5, application/json", true},
+		{"text/html, application/json;q=0.5", false},
+		{"application/json;q=0", false},
+		{"application/json;q=bad", false},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if v.accept != "" {
+			r.Header.Set("Accept", v.accept)
+		}
+		if got := acceptsJSON(r); got != v.expected {
+			t.Errorf("Case %d:  Unexpected result, got %v", i, got)
+		}
+	}
+}
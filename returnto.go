@@ -0,0 +1,101 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The constant DefaultReturnToParam contains the name of the query parameter
+// that holds the URL originally requested by clients that were redirected
+// to the login page.
+const DefaultReturnToParam = "return_to"
+
+// The function loginPageURL returns the URL of the login page, with the URL
+// of the request attached so that the client can return after logging in.
+// Only the URLs of GET requests are attached, as other requests cannot be
+// repeated by a redirection.
+func (a *Cookie) loginPageURL(r *http.Request) string {
+	if a.ReturnToParam == "" || r.Method != "GET" {
+		return a.LoginPage
+	}
+
+	u, err := url.Parse(a.LoginPage)
+	if err != nil {
+		return a.LoginPage
+	}
+	query := u.Query()
+	query.Set(a.ReturnToParam, r.URL.RequestURI())
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// ReturnURL returns the URL that the client should be redirected to after
+// logging in.  This is the URL attached to the login page by
+// NotifyAuthRequired, which is read from the form or the query of the
+// request.  The URL is only returned if it is on the same host as the
+// request, or on one of the AllowedReturnHosts, so that the login page
+// cannot be used to redirect clients to other sites.  Otherwise, the
+// fallback is returned.
+func (a *Cookie) ReturnURL(r *http.Request, fallback string) string {
+	if a.ReturnToParam == "" {
+		return fallback
+	}
+
+	target := r.PostForm.Get(a.ReturnToParam)
+	if target == "" {
+		target = r.URL.Query().Get(a.ReturnToParam)
+	}
+	if target == "" || !a.isSafeReturnURL(r, target) {
+		return fallback
+	}
+	return target
+}
+
+// The function isSafeReturnURL returns whether or not the client can be
+// redirected to the URL.  Relative URLs must be absolute paths, and absolute
+// URLs must use HTTP or HTTPS to reach an allowed host.
+func (a *Cookie) isSafeReturnURL(r *http.Request, target string) bool {
+	if !isSafePath(target) {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.User != nil || u.Opaque != "" || !isSafePath(u.Path) {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// Browsers treat '///evil.com' as a reference to another host,
+		// although it is parsed as a path
+		return strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(u.Path, "//")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, host := range a.AllowedReturnHosts {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// The function isSafePath checks the URL, or its decoded path, for
+// characters that browsers treat inconsistently.  Browsers treat
+// backslashes as slashes, so that '/\evil.com' is a reference to another
+// host, and control characters are stripped.
+func isSafePath(value string) bool {
+	return !strings.ContainsAny(value, "\\") && strings.IndexFunc(value, isControl) < 0
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCookieReturnToParam(t *testing.T) {
+	policy := NewCookie("golang", "/login?lang=en", func(username, password, realm string) bool {
+		return username == password
+	})
+
+	cases := []struct {
+		method   string
+		target   string
+		expected string
+	}{
+		{"GET", "/private/page?a=1", "/login?lang=en&return_to=%2Fprivate%2Fpage%3Fa%3D1"},
+		{"POST", "/private/page", "/login?lang=en"},
+	}
+
+	for i, v := range cases {
+		w := httptest.NewRecorder()
+		policy.NotifyAuthRequired(w, httptest.NewRequest(v.method, v.target, nil))
+		if loc := w.Header().Get("Location"); loc != v.expected {
+			t.Errorf("Case %d:  Unexpected redirect, got %s", i, loc)
+		}
+	}
+
+	policy.ReturnToParam = ""
+	w := httptest.NewRecorder()
+	policy.NotifyAuthRequired(w, httptest.NewRequest("GET", "/private/page", nil))
+	if loc := w.Header().Get("Location"); loc != "/login?lang=en" {
+		t.Errorf("Unexpected redirect, got %s", loc)
+	}
+}
+
+func TestCookieReturnURL(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	policy.AllowedReturnHosts = []string{"static.example.com"}
+
+	cases := []struct {
+		target   string
+		expected string
+	}{
+		{"", "/home"},
+		{"/private/page?a=1", "/private/page?a=1"},
+		{"http://example.com/page", "http://example.com/page"},
+		{"https://STATIC.example.com/page", "https://STATIC.example.com/page"},
+		{"https://evil.com/page", "/home"},
+		{"//evil.com/page", "/home"},
+		{"///evil.com/page", "/home"},
+		{"////evil.com/page", "/home"},
+		{"/%2F/evil.com/page", "/home"},
+		{"/%09/evil.com/page", "/home"},
+		{"/%5Cevil.com/page", "/home"},
+		{"/\\evil.com/page", "/home"},
+		{"/\t/evil.com/page", "/home"},
+		{"https://user@evil.com/page", "/home"},
+		{"javascript:alert(1)", "/home"},
+		{"page", "/home"},
+	}
+
+	for i, v := range cases {
+		r := httptest.NewRequest("GET", "http://example.com/login?"+url.Values{"return_to": {v.target}}.Encode(), nil)
+		if got := policy.ReturnURL(r, "/home"); got != v.expected {
+			t.Errorf("Case %d:  Unexpected URL, got %s", i, got)
+		}
+	}
+}
+
+func TestLoginHandlerReturnTo(t *testing.T) {
+	policy := NewCookie("golang", "/login", func(username, password, realm string) bool {
+		return username == password
+	})
+	handler := policy.LoginHandler(&LoginOptions{SuccessURL: "/home"})
+
+	cases := []struct {
+		target   string
+		expected string
+	}{
+		{"/private/page", "/private/page"},
+		{"https://evil.com/", "/home"},
+	}
+
+	for i, v := range cases {
+		body := url.Values{"username": {"user1"}, "password": {"user1"}}.Encode()
+		r := httptest.NewRequest("POST", "/login?"+url.Values{"return_to": {v.target}}.Encode(), strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("Case %d:  Unexpected status code, got %d", i, w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != v.expected {
+			t.Errorf("Case %d:  Unexpected redirect, got %s", i, loc)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"sync"
+	"time"
+)
+
+// A RevocationList records stateless sessions that have been logged out
+// before they expired.  Sessions only need to be recorded until they
+// expire, after which they are rejected anyway.  Replicas that need to
+// share logouts can implement the interface using a shared database.
+type RevocationList interface {
+	// Revoke records that the session is no longer valid.
+	Revoke(sessionID string, expires time.Time)
+	// IsRevoked returns whether or not the session has been revoked.
+	IsRevoked(sessionID string) bool
+}
+
+type memoryRevocationList struct {
+	mutex    sync.Mutex
+	sessions map[string]time.Time
+}
+
+// NewRevocationList creates a revocation list that is held in memory.  The
+// list is safe for concurrent use.
+func NewRevocationList() RevocationList {
+	return &memoryRevocationList{sync.Mutex{}, make(map[string]time.Time)}
+}
+
+func (l *memoryRevocationList) Revoke(sessionID string, expires time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Remove sessions that have expired, to keep the list small
+	now := time.Now()
+	for id, t := range l.sessions {
+		if !t.After(now) {
+			delete(l.sessions, id)
+		}
+	}
+	l.sessions[sessionID] = expires
+}
+
+func (l *memoryRevocationList) IsRevoked(sessionID string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, ok := l.sessions[sessionID]
+	return ok
+}
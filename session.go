@@ -0,0 +1,314 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Session describes a login session held by a SessionStore.
+type Session struct {
+	// ID identifies the session.  It is stored by the client in a cookie,
+	// and so must be unguessable.
+	ID string
+	// Username is the user that logged in.
+	Username string
+	// Created is the time of the login.
+	Created time.Time
+	// LastContact is the time of the last request authorized using the
+	// session.
+	LastContact time.Time
+	// Values holds data that the application attached to the session.  See
+	// SessionData.
+	Values map[string]string
+	// Flashes holds messages that will be shown to the user once.
+	Flashes []string
+}
+
+// The function clone returns a copy of the session that does not share the
+// values or the flashes.
+func (s *Session) clone() Session {
+	ret := *s
+	if s.Values != nil {
+		ret.Values = make(map[string]string, len(s.Values))
+		for k, v := range s.Values {
+			ret.Values[k] = v
+		}
+	}
+	if s.Flashes != nil {
+		ret.Flashes = append([]string(nil), s.Flashes...)
+	}
+	return ret
+}
+
+// A SessionStore holds the login sessions used by the Cookie policy, and by
+// other policies that identify clients using a cookie.  Stores must be safe
+// for concurrent use.  The default store, created by NewMemoryStore, keeps
+// the sessions in memory.  Other implementations can keep sessions in a
+// database, so that the sessions survive restarts or are shared between
+// replicas.
+//
+// The sessions returned by stores are copies, so changes to them do not
+// affect the store.  Errors are only returned if the store itself fails.
+// Missing sessions are not an error.
+type SessionStore interface {
+	// Create creates a new session for the user.
+	Create(username string) (*Session, error)
+	// Lookup returns the session with the ID, or nil if there is no such
+	// session.  The time of last contact for the session is updated.
+	Lookup(id string) (*Session, error)
+	// Save replaces the values and the flashes of the session with those of
+	// the argument.  If the session no longer exists, it is not recreated.
+	Save(session *Session) error
+	// Regenerate replaces the ID of the session with a new ID, and returns
+	// the updated session, or nil if there is no such session.  The old ID
+	// is no longer valid.  The rest of the session is preserved.
+	Regenerate(id string) (*Session, error)
+	// Delete removes the session with the ID.
+	Delete(id string) error
+	// DeleteUser removes all of the sessions for the user.
+	DeleteUser(username string) error
+	// List returns the sessions for the user, ordered by the time they
+	// were created.
+	List(username string) ([]*Session, error)
+	// Expire removes the sessions whose last contact was before
+	// lastContactBefore (idle sessions), and the sessions that were created
+	// before createdBefore (old sessions).  A zero time removes no sessions.
+	Expire(lastContactBefore, createdBefore time.Time) error
+}
+
+// The following constants select the order of a sessionPriorityQueue.
+const (
+	byLastContact = iota
+	byCreated
+)
+
+type memorySession struct {
+	Session
+	index [2]int // index of the session in each priority queue
+}
+
+// A sessionPriorityQueue orders sessions either by the time of last
+// contact, or by the time they were created.
+type sessionPriorityQueue struct {
+	sessions []*memorySession
+	order    int
+}
+
+func (pq *sessionPriorityQueue) Len() int {
+	return len(pq.sessions)
+}
+
+func (pq *sessionPriorityQueue) Less(i, j int) bool {
+	if pq.order == byCreated {
+		return pq.sessions[i].Created.Before(pq.sessions[j].Created)
+	}
+	return pq.sessions[i].LastContact.Before(pq.sessions[j].LastContact)
+}
+
+func (pq *sessionPriorityQueue) Swap(i, j int) {
+	pq.sessions[i], pq.sessions[j] = pq.sessions[j], pq.sessions[i]
+	pq.sessions[i].index[pq.order] = i
+	pq.sessions[j].index[pq.order] = j
+}
+
+func (pq *sessionPriorityQueue) Push(x interface{}) {
+	s := x.(*memorySession)
+	s.index[pq.order] = len(pq.sessions)
+	pq.sessions = append(pq.sessions, s)
+}
+
+func (pq *sessionPriorityQueue) Pop() interface{} {
+	n := len(pq.sessions)
+	ret := pq.sessions[n-1]
+	pq.sessions = pq.sessions[:n-1]
+	return ret
+}
+
+// The function MinValue returns the session that comes first in the order
+// of the queue, or nil if the queue is empty.
+func (pq *sessionPriorityQueue) MinValue() *memorySession {
+	if len(pq.sessions) == 0 {
+		return nil
+	}
+	return pq.sessions[0]
+}
+
+type memoryStore struct {
+	mutex  sync.Mutex
+	byID   map[string]*memorySession
+	byUser map[string]map[string]*memorySession
+	lru    sessionPriorityQueue // ordered by last contact
+	oldest sessionPriorityQueue // ordered by creation
+}
+
+// NewMemoryStore creates a session store that keeps the sessions in memory.
+// Sessions are lost when the process exits.
+func NewMemoryStore() SessionStore {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		sync.Mutex{},
+		make(map[string]*memorySession),
+		make(map[string]map[string]*memorySession),
+		sessionPriorityQueue{nil, byLastContact},
+		sessionPriorityQueue{nil, byCreated}}
+}
+
+func (s *memoryStore) Create(username string) (*Session, error) {
+	id, err := createNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{id, username, now, now, nil, nil}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.insert(session)
+	return &session, nil
+}
+
+// The function insert adds the session to the maps and to the priority
+// queues.  The caller must hold the lock.
+func (s *memoryStore) insert(v Session) {
+	session := &memorySession{v.clone(), [2]int{}}
+	s.byID[v.ID] = session
+	if s.byUser[v.Username] == nil {
+		s.byUser[v.Username] = make(map[string]*memorySession)
+	}
+	s.byUser[v.Username][v.ID] = session
+	heap.Push(&s.lru, session)
+	heap.Push(&s.oldest, session)
+}
+
+func (s *memoryStore) Lookup(id string) (*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	session.LastContact = time.Now()
+	heap.Fix(&s.lru, session.index[byLastContact])
+
+	ret := session.clone()
+	return &ret, nil
+}
+
+func (s *memoryStore) Save(v *Session) error {
+	clone := v.clone()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if session, ok := s.byID[v.ID]; ok {
+		session.Values, session.Flashes = clone.Values, clone.Flashes
+	}
+	return nil
+}
+
+func (s *memoryStore) Regenerate(id string) (*Session, error) {
+	newID, err := createNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	v := session.clone()
+	v.ID = newID
+	s.remove(session)
+	s.insert(v)
+	return &v, nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if session, ok := s.byID[id]; ok {
+		s.remove(session)
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteUser(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, session := range s.byUser[username] {
+		s.remove(session)
+	}
+	return nil
+}
+
+func (s *memoryStore) List(username string) ([]*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret := make([]*Session, 0, len(s.byUser[username]))
+	for _, session := range s.byUser[username] {
+		v := session.clone()
+		ret = append(ret, &v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+	return ret, nil
+}
+
+func (s *memoryStore) Expire(lastContactBefore, createdBefore time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.expired(lastContactBefore, createdBefore) {
+		if v := s.lru.MinValue(); v != nil && v.LastContact.Before(lastContactBefore) {
+			s.remove(v)
+		} else {
+			s.remove(s.oldest.MinValue())
+		}
+	}
+	return nil
+}
+
+// The function expired returns whether or not any session should be
+// removed by Expire.  The caller must hold the lock.
+func (s *memoryStore) expired(lastContactBefore, createdBefore time.Time) bool {
+	if v := s.lru.MinValue(); v != nil && v.LastContact.Before(lastContactBefore) {
+		return true
+	}
+	if v := s.oldest.MinValue(); v != nil && v.Created.Before(createdBefore) {
+		return true
+	}
+	return false
+}
+
+// The function remove deletes the session from the maps and from the
+// priority queues.  The caller must hold the lock.
+func (s *memoryStore) remove(session *memorySession) {
+	delete(s.byID, session.ID)
+	if sessions := s.byUser[session.Username]; sessions != nil {
+		delete(sessions, session.ID)
+		if len(sessions) == 0 {
+			delete(s.byUser, session.Username)
+		}
+	}
+	heap.Remove(&s.lru, session.index[byLastContact])
+	heap.Remove(&s.oldest, session.index[byCreated])
+}
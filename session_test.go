@@ -0,0 +1,153 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	s1, err := store.Create("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s2, err := store.Create("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s3, err := store.Create("user2")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if s1.ID == s2.ID || s1.Username != "user1" || s1.Created.IsZero() {
+		t.Errorf("Incorrect session: %v", s1)
+	}
+
+	// Lookup
+	if session, err := store.Lookup(s1.ID); err != nil || session == nil || session.Username != "user1" {
+		t.Errorf("Incorrect session: %v %v", session, err)
+	}
+	if session, err := store.Lookup("unknown"); err != nil || session != nil {
+		t.Errorf("Incorrect session: %v %v", session, err)
+	}
+
+	// List
+	sessions, err := store.List("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != s1.ID || sessions[1].ID != s2.ID {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+
+	// Save
+	s3.Values = map[string]string{"colour": "blue"}
+	if err := store.Save(s3); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s3.Values["colour"] = "red"
+	if session, _ := store.Lookup(s3.ID); session == nil || session.Values["colour"] != "blue" {
+		t.Errorf("Incorrect session: %v", session)
+	}
+
+	// Regenerate
+	s4, err := store.Regenerate(s3.ID)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if s4 == nil || s4.ID == s3.ID || s4.Username != "user2" || !s4.Created.Equal(s3.Created) || s4.Values["colour"] != "blue" {
+		t.Errorf("Incorrect session: %v", s4)
+	}
+	if session, _ := store.Lookup(s3.ID); session != nil {
+		t.Errorf("Old session ID is still valid.")
+	}
+	if session, err := store.Regenerate("unknown"); err != nil || session != nil {
+		t.Errorf("Incorrect session: %v %v", session, err)
+	}
+	s3 = s4
+
+	// Delete
+	if err := store.Delete(s1.ID); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if session, _ := store.Lookup(s1.ID); session != nil {
+		t.Errorf("Session was not deleted.")
+	}
+	if session, _ := store.Lookup(s2.ID); session == nil {
+		t.Errorf("Incorrect session was deleted.")
+	}
+
+	// DeleteUser
+	if err := store.DeleteUser("user1"); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if sessions, _ := store.List("user1"); len(sessions) != 0 {
+		t.Errorf("Sessions were not deleted: %v", sessions)
+	}
+	if session, _ := store.Lookup(s3.ID); session == nil {
+		t.Errorf("Incorrect session was deleted.")
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	store := NewMemoryStore()
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		session, err := store.Create("user")
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		ids = append(ids, session.ID)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+
+	// Sessions that are used are kept, regardless of when they were
+	// created
+	store.Lookup(ids[0])
+	store.Lookup(ids[5])
+	if err := store.Expire(cutoff, time.Time{}); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	sessions, err := store.List("user")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != ids[0] || sessions[1].ID != ids[5] {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+}
+
+func TestMemoryStoreExpireCreated(t *testing.T) {
+	store := NewMemoryStore()
+
+	old, err := store.Create("user")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	recent, err := store.Create("user")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	// Sessions are removed based on their creation, even if they are used
+	store.Lookup(old.ID)
+	if err := store.Expire(time.Time{}, cutoff); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if session, _ := store.Lookup(old.ID); session != nil {
+		t.Errorf("Old session was not removed.")
+	}
+	if session, _ := store.Lookup(recent.ID); session == nil {
+		t.Errorf("Recent session was removed.")
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionData holds the data attached to the session of an authorized
+// client.  Handlers wrapped using NewHandlerWithAuth can retrieve the data
+// for the request's session using SessionDataFromContext.  Changes are saved
+// to the policy's session store once the handler returns.  SessionData is
+// safe for concurrent use, but concurrent requests for the same session
+// each save all of their data, so the last request to finish wins.
+type SessionData struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	flashes  []string
+	modified bool
+
+	// The session that the data belongs to, which is updated by Regenerate
+	// and Logout during the request
+	policy  *Cookie       // policy that loaded the session
+	session *Session      // stored session, or nil
+	token   *sessionToken // stateless session, or nil
+}
+
+func newSessionData(values map[string]string, flashes []string) *SessionData {
+	d := &SessionData{values: make(map[string]string, len(values))}
+	for k, v := range values {
+		d.values[k] = v
+	}
+	d.flashes = append(d.flashes, flashes...)
+	return d
+}
+
+// Get returns the value for the key, and whether or not the key was set.
+func (d *SessionData) Get(key string) (value string, ok bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	value, ok = d.values[key]
+	return value, ok
+}
+
+// Set sets the value for the key.
+func (d *SessionData) Set(key, value string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.values[key] = value
+	d.modified = true
+}
+
+// Delete removes the key.
+func (d *SessionData) Delete(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.values[key]; ok {
+		delete(d.values, key)
+		d.modified = true
+	}
+}
+
+// AddFlash adds a message that will be returned by the next call to Flashes,
+// which will usually be for a later request, such as after a redirection.
+func (d *SessionData) AddFlash(message string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.flashes = append(d.flashes, message)
+	d.modified = true
+}
+
+// Flashes returns the messages added using AddFlash, and then removes them,
+// so that each message is only shown once.
+func (d *SessionData) Flashes() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ret := d.flashes
+	if len(ret) > 0 {
+		d.flashes = nil
+		d.modified = true
+	}
+	return ret
+}
+
+// The function snapshot returns copies of the values and the flashes, and
+// whether or not they were modified since they were loaded.
+func (d *SessionData) snapshot() (values map[string]string, flashes []string, modified bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	values = make(map[string]string, len(d.values))
+	for k, v := range d.values {
+		values[k] = v
+	}
+	return values, append([]string(nil), d.flashes...), d.modified
+}
+
+const sessionDataKey contextKey = 1
+
+// The function loadedSession returns the session data attached to the
+// request by this policy's LoadSession, if any.
+func (a *Cookie) loadedSession(r *http.Request) *SessionData {
+	if data, ok := SessionDataFromContext(r.Context()); ok && data.policy == a {
+		return data
+	}
+	return nil
+}
+
+// The function storedSession returns a copy of the stored session that the
+// data belongs to, or nil if the session was logged out.
+func (d *SessionData) storedSession() *Session {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.session == nil {
+		return nil
+	}
+	ret := *d.session
+	return &ret
+}
+
+// The function statelessSession returns a copy of the stateless session
+// that the data belongs to, or false if the session was logged out.
+func (d *SessionData) statelessSession() (sessionToken, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.token == nil {
+		return sessionToken{}, false
+	}
+	return *d.token, true
+}
+
+// The function setSession replaces the session that the data belongs to.
+// Passing nil for both marks the session as logged out, so that the data is
+// not saved.
+func (d *SessionData) setSession(session *Session, token *sessionToken) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.session, d.token = session, token
+}
+
+// SessionDataFromContext retrieves the session data stored in the context,
+// if any.
+func SessionDataFromContext(ctx context.Context) (data *SessionData, ok bool) {
+	data, ok = ctx.Value(sessionDataKey).(*SessionData)
+	return data, ok && data != nil
+}
+
+// A sessionWriter calls commit before the headers of the response are
+// written, so that cookies can still be set.
+type sessionWriter struct {
+	http.ResponseWriter
+	once   sync.Once
+	commit func()
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.once.Do(w.commit)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.once.Do(w.commit)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) Flush() {
+	w.once.Do(w.commit)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original response writer, for http.ResponseController.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// LoadSession attaches the data of the session associated with the HTTP
+// request to the request's context.  It returns the response writer and the
+// request to be passed to the handler, and a function that saves any
+// changes to the data, which must be called once the handler returns.
+// NewHandlerWithAuth calls LoadSession automatically.  If the request does
+// not have a valid session, or the session data has already been loaded,
+// the arguments are returned unchanged.
+//
+// For stateless sessions, the data is stored in the token, and so must be
+// small enough to fit in a cookie.  The token is replaced on the response
+// before its headers are written, so changes made afterwards are lost.
+//
+// Calls to Regenerate and Logout during the request update the session
+// that the data is saved to.
+func (a *Cookie) LoadSession(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func() error) {
+	noop := func() error { return nil }
+	if _, ok := SessionDataFromContext(r.Context()); ok {
+		return w, r, noop
+	}
+	token, err := r.Cookie(a.CookieOptions.CookieName())
+	if err != nil || token.Value == "" {
+		return w, r, noop
+	}
+
+	if a.stateless() {
+		session, ok := a.verifySession(token.Value)
+		if !ok {
+			return w, r, noop
+		}
+		data := newSessionData(session.values, session.flashes)
+		data.policy, data.token = a, &session
+
+		var saveErr error
+		sw := &sessionWriter{ResponseWriter: w}
+		sw.commit = func() {
+			values, flashes, modified := data.snapshot()
+			session, ok := data.statelessSession()
+			if !modified || !ok {
+				return
+			}
+			session.values, session.flashes = values, flashes
+			nonce, err := a.encodeSession(session)
+			if err != nil {
+				saveErr = err
+				return
+			}
+			var expires time.Time
+			if a.SessionLifetime > 0 {
+				expires = session.expires
+			}
+			a.setCookie(w, nonce, expires)
+		}
+		return sw, r.WithContext(context.WithValue(r.Context(), sessionDataKey, data)), func() error {
+			sw.once.Do(sw.commit)
+			return saveErr
+		}
+	}
+
+	session, err := a.Sessions.Lookup(token.Value)
+	if err != nil || session == nil {
+		return w, r, noop
+	}
+	data := newSessionData(session.Values, session.Flashes)
+	data.policy, data.session = a, session
+	return w, r.WithContext(context.WithValue(r.Context(), sessionDataKey, data)), func() error {
+		values, flashes, modified := data.snapshot()
+		session := data.storedSession()
+		if !modified || session == nil {
+			return nil
+		}
+		session.Values, session.Flashes = values, flashes
+		return a.Sessions.Save(session)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionData(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		if stateless {
+			codec, err := NewAEADCodec([][]byte{[]byte("0123456789abcdef")})
+			if err != nil {
+				t.Fatalf("Error:  %s", err)
+			}
+			policy.SessionCodec = codec
+		}
+
+		handler := NewHandlerWithAuth(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, ok := SessionDataFromContext(r.Context())
+			if !ok {
+				t.Fatalf("Missing session data.")
+			}
+			switch r.URL.Path {
+			case "/set":
+				data.Set("colour", "blue")
+				data.AddFlash("Saved.")
+			case "/delete":
+				data.Delete("colour")
+			}
+			colour, _ := data.Get("colour")
+			fmt.Fprintf(w, "colour=%s flashes=%v", colour, data.Flashes())
+		}))
+
+		w := httptest.NewRecorder()
+		if err := policy.Login(w, "user1", "user1"); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		cookie := w.Result().Cookies()[0]
+
+		get := func(path string) string {
+			r := httptest.NewRequest("GET", path, nil)
+			r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			// Stateless sessions replace the cookie when the data changes
+			for _, v := range w.Result().Cookies() {
+				cookie = v
+			}
+			return w.Body.String()
+		}
+
+		cases := []struct {
+			path     string
+			expected string
+		}{
+			{"/", "colour= flashes=[]"},
+			{"/set", "colour=blue flashes=[Saved.]"},
+			{"/set", "colour=blue flashes=[Saved.]"},
+			{"/", "colour=blue flashes=[]"},
+			{"/delete", "colour= flashes=[]"},
+			{"/", "colour= flashes=[]"},
+		}
+		for i, v := range cases {
+			if body := get(v.path); body != v.expected {
+				t.Errorf("Case %d (stateless %v): incorrect body: %q", i, stateless, body)
+			}
+		}
+	}
+}
+
+func TestSessionDataFlashes(t *testing.T) {
+	data := newSessionData(nil, []string{"one"})
+	data.AddFlash("two")
+	if flashes := data.Flashes(); len(flashes) != 2 || flashes[0] != "one" || flashes[1] != "two" {
+		t.Errorf("Incorrect flashes: %v", flashes)
+	}
+	if flashes := data.Flashes(); len(flashes) != 0 {
+		t.Errorf("Flashes were returned twice: %v", flashes)
+	}
+	if _, _, modified := data.snapshot(); !modified {
+		t.Errorf("Reading flashes did not modify the session.")
+	}
+}
+
+func TestSessionDataRegenerate(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		if stateless {
+			policy.SessionSecrets = [][]byte{[]byte("secret")}
+			policy.Revoked = NewRevocationList()
+		}
+
+		handler := NewHandlerWithAuth(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := SessionDataFromContext(r.Context())
+			switch r.URL.Path {
+			case "/regenerate":
+				data.Set("colour", "blue")
+				if err := policy.Regenerate(w, r); err != nil {
+					t.Errorf("Error:  %s", err)
+				}
+				data.Set("size", "large")
+			case "/logout":
+				data.Set("colour", "red")
+				if err := policy.Logout(w, r); err != nil {
+					t.Errorf("Error:  %s", err)
+				}
+			}
+			colour, _ := data.Get("colour")
+			size, _ := data.Get("size")
+			fmt.Fprintf(w, "colour=%s size=%s", colour, size)
+		}))
+
+		w := httptest.NewRecorder()
+		if err := policy.Login(w, "user1", "user1"); err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		cookie := w.Result().Cookies()[0]
+		old := cookie.Value
+
+		get := func(path string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", path, nil)
+			r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		// The response sets a single cookie, holding the new token and all
+		// of the changes to the data
+		w = get("/regenerate")
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value == old {
+			t.Fatalf("Incorrect cookies (stateless %v): %v", stateless, cookies)
+		}
+		cookie = cookies[0]
+
+		if w = get("/"); w.Code != http.StatusOK || w.Body.String() != "colour=blue size=large" {
+			t.Errorf("Incorrect response (stateless %v): %d %q", stateless, w.Code, w.Body.String())
+		}
+		if policy.Authorize(requestWithCookie(cookie.Name, old)) != "" {
+			t.Errorf("Old token still valid (stateless %v)", stateless)
+		}
+
+		// Logging out of a regenerated session must not save the session
+		w = get("/logout")
+		cookies = w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("Incorrect cookies (stateless %v): %v", stateless, cookies)
+		}
+		if policy.Authorize(requestWithCookie(cookie.Name, cookie.Value)) != "" {
+			t.Errorf("Session still valid after logout (stateless %v)", stateless)
+		}
+	}
+}
+
+func requestWithCookie(name, value string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+	return r
+}
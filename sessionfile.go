@@ -0,0 +1,152 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// The constant sessionFileTouchInterval limits how often the file is saved
+// only to record the last contact of sessions.
+const sessionFileTouchInterval = time.Minute
+
+type fileStore struct {
+	*memoryStore
+	path string
+
+	saveMutex sync.Mutex // held while saving the file
+	lastSave  time.Time  // protected by saveMutex
+}
+
+// OpenSessionFile creates a session store that keeps the sessions in memory,
+// but also saves them to a file, so that sessions survive restarts.  If the
+// file exists, the sessions are loaded.  Sessions whose last contact was more
+// than residence ago are dropped when loading, so that the expiry used by
+// the Cookie policy (ClientCacheResidence) is honoured across restarts.  If
+// residence is zero, all sessions are loaded.
+//
+// The file holds a JSON snapshot of the sessions, which is replaced
+// atomically after every change.  Since session IDs grant access to the
+// sessions, the file is only readable by its owner.  To limit the number of
+// writes, the last contact of sessions is only saved once per minute.
+func OpenSessionFile(filename string, residence time.Duration) (SessionStore, error) {
+	s := &fileStore{memoryStore: newMemoryStore(), path: filename}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var sessions []Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, err
+		}
+		cutoff := time.Now().Add(-residence)
+		for _, v := range sessions {
+			if residence == 0 || !v.LastContact.Before(cutoff) {
+				s.insert(v)
+			}
+		}
+	}
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileStore) Create(username string) (*Session, error) {
+	session, err := s.memoryStore.Create(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		// Don't hand out sessions that would be lost on restart
+		s.memoryStore.Delete(session.ID)
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *fileStore) Lookup(id string) (*Session, error) {
+	session, err := s.memoryStore.Lookup(id)
+	if err != nil || session == nil {
+		return session, err
+	}
+
+	s.saveMutex.Lock()
+	stale := time.Since(s.lastSave) >= sessionFileTouchInterval
+	s.saveMutex.Unlock()
+	if stale {
+		// The last contact is only advisory, so errors are ignored, and
+		// the file will be saved again by the next change.
+		s.save()
+	}
+	return session, nil
+}
+
+func (s *fileStore) Save(session *Session) error {
+	s.memoryStore.Save(session)
+	return s.save()
+}
+
+func (s *fileStore) Regenerate(id string) (*Session, error) {
+	session, err := s.memoryStore.Regenerate(id)
+	if err != nil || session == nil {
+		return session, err
+	}
+	return session, s.save()
+}
+
+func (s *fileStore) Delete(id string) error {
+	s.memoryStore.Delete(id)
+	return s.save()
+}
+
+func (s *fileStore) DeleteUser(username string) error {
+	s.memoryStore.DeleteUser(username)
+	return s.save()
+}
+
+func (s *fileStore) Expire(lastContactBefore, createdBefore time.Time) error {
+	s.mutex.Lock()
+	expired := s.expired(lastContactBefore, createdBefore)
+	s.mutex.Unlock()
+	if !expired {
+		return nil
+	}
+
+	s.memoryStore.Expire(lastContactBefore, createdBefore)
+	return s.save()
+}
+
+// The function save writes a snapshot of the sessions to the file.  Saves
+// are serialized, and the snapshot is taken after acquiring the lock, so
+// that the file always ends up holding the latest sessions.
+func (s *fileStore) save() error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	s.mutex.Lock()
+	sessions := make([]Session, 0, len(s.byID))
+	for _, v := range s.byID {
+		sessions = append(sessions, v.Session)
+	}
+	s.mutex.Unlock()
+
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data, 0600); err != nil {
+		return err
+	}
+	s.lastSave = time.Now()
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Robert W. Johnstone. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenSessionFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sessions.json")
+
+	store, err := OpenSessionFile(filename, time.Hour)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s1, err := store.Create("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s2, err := store.Create("user2")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := store.Delete(s2.ID); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	s1.Values = map[string]string{"colour": "blue"}
+	if err := store.Save(s1); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatalf("Error:  %s", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("Incorrect permissions: %s", info.Mode())
+	}
+
+	// The sessions survive a restart
+	store, err = OpenSessionFile(filename, time.Hour)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if session, err := store.Lookup(s1.ID); err != nil || session == nil || session.Username != "user1" || session.Values["colour"] != "blue" {
+		t.Errorf("Incorrect session: %v %v", session, err)
+	}
+	if session, _ := store.Lookup(s2.ID); session != nil {
+		t.Errorf("Deleted session was restored.")
+	}
+}
+
+func TestOpenSessionFileResidence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sessions.json")
+
+	now := time.Now()
+	data, err := json.Marshal([]Session{
+		{"old", "user1", now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), nil, nil},
+		{"new", "user1", now.Add(-3 * time.Hour), now.Add(-time.Minute), nil, nil},
+	})
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	store, err := OpenSessionFile(filename, time.Hour)
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	sessions, err := store.List("user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "new" {
+		t.Errorf("Incorrect sessions: %v", sessions)
+	}
+
+	// Malformed files are reported
+	if err := ioutil.WriteFile(filename, []byte("not json"), 0600); err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	if _, err := OpenSessionFile(filename, time.Hour); err == nil {
+		t.Errorf("Opened a malformed file.")
+	}
+}
+
+func TestCookieSessionFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpauth")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sessions.json")
+
+	newPolicy := func() *Cookie {
+		policy := NewCookie("golang", "/cookie/login/", func(username, password, realm string) bool {
+			return realm == "golang" && username == password
+		})
+		store, err := OpenSessionFile(filename, policy.ClientCacheResidence)
+		if err != nil {
+			t.Fatalf("Error:  %s", err)
+		}
+		policy.Sessions = store
+		return policy
+	}
+
+	nonce, err := newPolicy().createSession("user1", "user1")
+	if err != nil {
+		t.Fatalf("Error:  %s", err)
+	}
+
+	// A new policy, as after a restart, accepts the session
+	policy := newPolicy()
+	if session, _ := policy.Sessions.Lookup(nonce); session == nil || session.Username != "user1" {
+		t.Errorf("Incorrect session: %v", session)
+	}
+}
@@ -8,6 +8,22 @@ import (
 	"net/http"
 )
 
+// An AuthorizedNotifier is a Policy that adds headers to the HTTP response
+// after a successful authorization.  NotifyAuthorized is called before the
+// response is written.
+type AuthorizedNotifier interface {
+	NotifyAuthorized(w http.ResponseWriter, request *http.Request)
+}
+
+// A SessionLoader is a Policy that keeps data for the sessions of
+// authorized clients.  LoadSession is called after NotifyAuthorized, and
+// returns the response writer and the request for the handler.  The
+// returned function is called once the handler returns, to save changes to
+// the data.
+type SessionLoader interface {
+	LoadSession(w http.ResponseWriter, request *http.Request) (http.ResponseWriter, *http.Request, func() error)
+}
+
 type authHandler struct {
 	auth    Policy
 	handler http.Handler
@@ -20,6 +36,29 @@ func (a *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Attach the client's identity to the request
+	var id *Identity
+	if identifier, ok := a.auth.(Identifier); ok {
+		id = identifier.Identify(r, username)
+	}
+	if id == nil {
+		id = &Identity{Username: username}
+	}
+	r = r.WithContext(NewContext(r.Context(), id))
+
+	// Let the policy add any headers for authorized clients
+	if notifier, ok := a.auth.(AuthorizedNotifier); ok {
+		notifier.NotifyAuthorized(w, r)
+	}
+
+	// Let the policy attach the session's data.  Errors while saving the
+	// data cannot be reported, as the response has been written.
+	if loader, ok := a.auth.(SessionLoader); ok {
+		var save func() error
+		w, r, save = loader.LoadSession(w, r)
+		defer save()
+	}
+
 	a.handler.ServeHTTP(w, r)
 }
 
@@ -27,9 +66,11 @@ func (a *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // credentials for authentication.  If successful, control will then
 // pass to the specified handler.
 //
-// Note, if the handler requires access to the username from the credentials,
-// then this function is not useable.  Instead, you will need to work with
-// the authorization policy directly.  See examples.
+// The identity of the authorized client is attached to the request's
+// context.  The handler can retrieve the username, and any additional
+// details supplied by the policy, using FromContext.  For policies with
+// sessions, the data of the session can be retrieved using
+// SessionDataFromContext.
 func NewHandlerWithAuth(auth Policy, handler http.Handler) http.Handler {
 	return &authHandler{auth, handler}
 }
@@ -13,6 +13,9 @@ import (
 // not verified, the header must simply exist.  This should prove that the
 // request was initiated using XMLHttpRequest, and therefore not by a
 // normal HTTP client.
+//
+// Deprecated: The check is only as strong as the CORS configuration of the
+// server, and cannot protect HTML forms.  Use Cookie.RequireCsrfToken.
 func VerifyXsrfHeader(req *http.Request) bool {
 	_, ok := req.Header["X-Xsrf-Cookie"]
 	return ok